@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"daily-diet-backend/middlewares"
+	"daily-diet-backend/models"
+	"daily-diet-backend/serializers"
+	"daily-diet-backend/services"
+	"daily-diet-backend/utils/errors"
+	"daily-diet-backend/utils/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type AdminController interface {
+	ListUsers(ctx *gin.Context)
+	GetUser(ctx *gin.Context)
+	SetRole(ctx *gin.Context)
+	DisableUser(ctx *gin.Context)
+	EnableUser(ctx *gin.Context)
+	ForceLogout(ctx *gin.Context)
+	RecomputeStats(ctx *gin.Context)
+}
+
+type adminController struct {
+	service services.AdminService
+}
+
+func NewAdminController(service services.AdminService) AdminController {
+	return &adminController{service: service}
+}
+
+func RegisterAdminRoutes(router *gin.RouterGroup, adminService services.AdminService, authService services.AuthService) {
+	adminController := NewAdminController(adminService)
+	adminRouter := router.Group("/admin")
+
+	adminRouter.Use(middlewares.AuthMiddleware(authService), middlewares.RequireRole(models.RoleAdmin))
+	logger.Log(logger.DEBUG, "Registering admin routes")
+	{
+		adminRouter.GET("/users", adminController.ListUsers)
+		adminRouter.GET("/users/:id", adminController.GetUser)
+		adminRouter.PATCH("/users/:id/role", adminController.SetRole)
+		adminRouter.POST("/users/:id/disable", adminController.DisableUser)
+		adminRouter.POST("/users/:id/enable", adminController.EnableUser)
+		adminRouter.POST("/users/:id/logout", adminController.ForceLogout)
+		adminRouter.POST("/users/:id/stats/recompute", adminController.RecomputeStats)
+	}
+}
+
+// parseAdminTarget reads the id of the target user and of the calling admin
+func parseAdminTarget(ctx *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	actorId, err := uuid.Parse(ctx.GetString("userId"))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	userId, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse user id"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userId, actorId, true
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description Lists users newest first, searchable by name or email and filterable by role and disabled state
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param q query string false "Name or email substring"
+// @Param role query string false "user, coach or admin"
+// @Param disabled query bool false "Only disabled (true) or enabled (false) accounts"
+// @Param cursor query string false "Cursor of the next page"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Success 200 {object} models.AdminUsersResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/users [get]
+func (controller *adminController) ListUsers(ctx *gin.Context) {
+	var query models.AdminListUsersQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := controller.service.ListUsers(ctx, query)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, serializers.AdminUsersPage(page))
+}
+
+// GetUser godoc
+// @Summary Get user
+// @Description Retrieves one user with its account state
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.AdminUserDTO
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/users/{id} [get]
+func (controller *adminController) GetUser(ctx *gin.Context) {
+	userId, _, ok := parseAdminTarget(ctx)
+	if !ok {
+		return
+	}
+
+	user, err := controller.service.GetUser(ctx, userId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, serializers.AdminUser(user))
+}
+
+// SetRole godoc
+// @Summary Change role
+// @Description Sets the role of a user, applied to the next access token of the user
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.SetRoleDTO true "New role"
+// @Success 200 {object} models.AdminUserDTO
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/users/{id}/role [patch]
+func (controller *adminController) SetRole(ctx *gin.Context) {
+	userId, actorId, ok := parseAdminTarget(ctx)
+	if !ok {
+		return
+	}
+	var req models.SetRoleDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := controller.service.SetRole(ctx, userId, req.Role, actorId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, serializers.AdminUser(user))
+}
+
+// DisableUser godoc
+// @Summary Disable account
+// @Description Blocks logins and refreshes of a user and signs out every session
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.AdminUserDTO
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/users/{id}/disable [post]
+func (controller *adminController) DisableUser(ctx *gin.Context) {
+	userId, actorId, ok := parseAdminTarget(ctx)
+	if !ok {
+		return
+	}
+
+	user, err := controller.service.DisableUser(ctx, userId, actorId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, serializers.AdminUser(user))
+}
+
+// EnableUser godoc
+// @Summary Enable account
+// @Description Lifts a disable, the user can log in again
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.AdminUserDTO
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/users/{id}/enable [post]
+func (controller *adminController) EnableUser(ctx *gin.Context) {
+	userId, actorId, ok := parseAdminTarget(ctx)
+	if !ok {
+		return
+	}
+
+	user, err := controller.service.EnableUser(ctx, userId, actorId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, serializers.AdminUser(user))
+}
+
+// ForceLogout godoc
+// @Summary Force logout
+// @Description Revokes every session of a user, their access tokens stop working right away
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/users/{id}/logout [post]
+func (controller *adminController) ForceLogout(ctx *gin.Context) {
+	userId, actorId, ok := parseAdminTarget(ctx)
+	if !ok {
+		return
+	}
+
+	if err := controller.service.ForceLogout(ctx, userId, actorId); err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// RecomputeStats godoc
+// @Summary Recompute user statistics
+// @Description Rebuilds the statistics of a user from the meal history
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.UserStatsDTO
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/users/{id}/stats/recompute [post]
+func (controller *adminController) RecomputeStats(ctx *gin.Context) {
+	userId, _, ok := parseAdminTarget(ctx)
+	if !ok {
+		return
+	}
+
+	stats, err := controller.service.RecomputeStats(ctx, userId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, serializers.UserStats(stats))
+}
@@ -1,17 +1,17 @@
 package controllers
 
 import (
+	"daily-diet-backend/middlewares"
 	"daily-diet-backend/models"
-	"daily-diet-backend/repositories"
+	"daily-diet-backend/serializers"
 	"daily-diet-backend/services"
+	"daily-diet-backend/utils/errors"
 	"daily-diet-backend/utils/logger"
 	"net/http"
-	"os"
-	"time"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-	"gorm.io/gorm"
+	"github.com/google/uuid"
 )
 
 type AuthController interface {
@@ -19,6 +19,21 @@ type AuthController interface {
 	SignIn(ctx *gin.Context)
 	GetUserByEmail(ctx *gin.Context)
 	RefreshTokenLogin(ctx *gin.Context)
+	Logout(ctx *gin.Context)
+	ListSessions(ctx *gin.Context)
+	RevokeSession(ctx *gin.Context)
+	ForgotPassword(ctx *gin.Context)
+	ResetPassword(ctx *gin.Context)
+	VerifyEmail(ctx *gin.Context)
+	ResendVerification(ctx *gin.Context)
+	LoginTwoFactor(ctx *gin.Context)
+	SetupTwoFactor(ctx *gin.Context)
+	EnableTwoFactor(ctx *gin.Context)
+	DisableTwoFactor(ctx *gin.Context)
+	OIDCAuthorize(ctx *gin.Context)
+	OIDCCallback(ctx *gin.Context)
+	RequestMagicLink(ctx *gin.Context)
+	ExchangeMagicLink(ctx *gin.Context)
 }
 
 type authController struct {
@@ -29,10 +44,7 @@ func NewAuthController(service services.AuthService) AuthController {
 	return &authController{service: service}
 }
 
-func RegisterAuthRoutes(router *gin.RouterGroup, client *gorm.DB) {
-	jwt := []byte(os.Getenv("JWT_SECRET"))
-	usersRepo := repositories.NewUserRepository(client)
-	authService := services.NewAuthService(usersRepo, jwt)
+func RegisterAuthRoutes(router *gin.RouterGroup, authService services.AuthService) {
 	authController := NewAuthController(authService)
 
 	authRouter := router.Group("/auth")
@@ -41,7 +53,33 @@ func RegisterAuthRoutes(router *gin.RouterGroup, client *gorm.DB) {
 		authRouter.POST("/register", authController.CreateUser)
 		authRouter.POST("/login", authController.SignIn)
 		authRouter.POST("/login/token", authController.RefreshTokenLogin)
-		authRouter.GET("/user/:email", authController.GetUserByEmail)
+		authRouter.POST("/login/2fa", authController.LoginTwoFactor)
+		authRouter.GET("/oidc/authorize", authController.OIDCAuthorize)
+		authRouter.POST("/oidc/callback", authController.OIDCCallback)
+		authRouter.POST("/magic-link", authController.RequestMagicLink)
+		authRouter.POST("/magic-link/exchange", authController.ExchangeMagicLink)
+		authRouter.GET("/user/:email", middlewares.AuthMiddleware(authService), authController.GetUserByEmail)
+		authRouter.POST("/logout", authController.Logout)
+		authRouter.POST("/password/forgot", authController.ForgotPassword)
+		authRouter.POST("/password/reset", authController.ResetPassword)
+		authRouter.GET("/verify", authController.VerifyEmail)
+		authRouter.POST("/verify", authController.VerifyEmail)
+		authRouter.POST("/verify/resend", authController.ResendVerification)
+	}
+
+	sessionsRouter := authRouter.Group("/sessions")
+	sessionsRouter.Use(middlewares.AuthMiddleware(authService))
+	{
+		sessionsRouter.GET("", authController.ListSessions)
+		sessionsRouter.DELETE("/:id", authController.RevokeSession)
+	}
+
+	twoFactorRouter := authRouter.Group("/2fa")
+	twoFactorRouter.Use(middlewares.AuthMiddleware(authService))
+	{
+		twoFactorRouter.POST("/setup", authController.SetupTwoFactor)
+		twoFactorRouter.POST("/enable", authController.EnableTwoFactor)
+		twoFactorRouter.POST("/disable", authController.DisableTwoFactor)
 	}
 }
 
@@ -59,126 +97,554 @@ func RegisterAuthRoutes(router *gin.RouterGroup, client *gorm.DB) {
 func (controller *authController) CreateUser(ctx *gin.Context) {
 	var req models.CreateUserDTO
 	if err := ctx.BindJSON(&req); err != nil {
-		ctx.JSON(400, gin.H{"error": "error parsing request"})
+		serializers.JSON(ctx, 400, gin.H{"error": "error parsing request"})
 		return
 	}
 
 	user, err := controller.service.CreateUser(ctx, req)
 	// is error from NewError
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": err.Error()})
+		serializers.JSON(ctx, 500, gin.H{"error": err.Error()})
 		return
 	}
 	var createdUser models.UserDTO = models.UserDTO{
 		Email: user.Email,
 		Name:  user.Name,
 	}
-	ctx.JSON(http.StatusCreated, createdUser)
+	serializers.JSON(ctx, http.StatusCreated, createdUser)
 }
 
 // GetUserByEmail godoc
 // @Summary Get user by email
-// @Description Retrieves user information by email address
+// @Description Retrieves a user profile by email address, only the user itself and admins are allowed
 // @Tags auth
 // @Accept json
 // @Produce json
+// @Security BearerAuth
 // @Param email path string true "User email"
-// @Success 302 {object} map[string]models.User
-// @Failure 400 {object} map[string]string
+// @Success 200 {object} map[string]models.UserProfileDTO
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
 // @Router /auth/user/{email} [get]
 func (controller *authController) GetUserByEmail(ctx *gin.Context) {
 	email := ctx.Param("email")
+	if !strings.EqualFold(email, ctx.GetString("email")) && ctx.GetString("role") != models.RoleAdmin {
+		serializers.JSON(ctx, http.StatusForbidden, gin.H{"error": "you are not allowed to see this user"})
+		return
+	}
 	user, err := controller.service.GetUserByEmail(ctx, email)
 	if err != nil {
-		ctx.JSON(400, gin.H{"error": "error parsing request"})
+		serializers.JSON(ctx, http.StatusNotFound, gin.H{"error": "user not found"})
+		return
 	}
-	ctx.JSON(http.StatusFound, gin.H{"user": user})
-}
-
-type SuccessResponse struct {
-	Token string `json:"token"`
+	serializers.JSON(ctx, http.StatusOK, gin.H{"user": serializers.UserProfile(user)})
 }
 
 // SignIn godoc
 // @Summary User login
-// @Description Authenticates a user and returns a JWT token
+// @Description Authenticates a user and returns a JWT token. When two factor authentication is enabled it returns two_factor_required and a challenge_token for /auth/login/2fa instead.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param login body models.LoginDTO true "Login credentials"
-// @Success 200 {object} SuccessResponse
+// @Success 200 {object} models.LoginResponseDTO
 // @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 429 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /auth/login [get]
 func (controller *authController) SignIn(ctx *gin.Context) {
 	var req models.LoginDTO
 	if err := ctx.BindJSON(&req); err != nil {
-		ctx.JSON(400, gin.H{"error": "error parsing request"})
+		serializers.JSON(ctx, 400, gin.H{"error": "error parsing request"})
 		return
 	}
 
+	req.ClientIP = ctx.ClientIP()
+
 	token, err := controller.service.Login(ctx, req)
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": err.Error()})
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	ctx.Set("Authorization", "Bearer "+token.Token)
-	ctx.JSON(http.StatusOK,
-		gin.H{
-			"token":         token.Token,
-			"refresh_token": token.RefreshToken,
+	respondLogin(ctx, token)
+}
+
+// respondLogin sends a session, or the challenge token when a second factor
+// is still needed
+func respondLogin(ctx *gin.Context, token *models.LoginResponse) {
+	if token.TwoFactorRequired {
+		serializers.JSON(ctx, http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     token.ChallengeToken,
 		})
+		return
+	}
+	ctx.Set("Authorization", "Bearer "+token.Token)
+	serializers.JSON(ctx, http.StatusOK, serializers.Login(token))
 }
 
-func (controller *authController) RefreshTokenLogin(ctx *gin.Context) {
-	var req struct {
-		RefreshToken string `json:"refresh_token"`
+// OIDCAuthorize godoc
+// @Summary Start single sign-on
+// @Description Returns the identity provider URL to send the user to. The provider redirects back to the configured redirect URL with a code and a state for /auth/oidc/callback.
+// @Tags auth
+// @Produce json
+// @Param device_id query string false "Device the session is bound to"
+// @Success 200 {object} models.OIDCAuthorizeResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/oidc/authorize [get]
+func (controller *authController) OIDCAuthorize(ctx *gin.Context) {
+	var req models.OIDCAuthorizeDTO
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := controller.service.OIDCAuthorize(ctx, req.DeviceID)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, response)
+}
+
+// OIDCCallback godoc
+// @Summary Finish single sign-on
+// @Description Exchanges the code and state the identity provider redirected with for a JWT and a refresh token. The account is linked by verified email on first sign-in. When two factor authentication is enabled it returns a challenge_token for /auth/login/2fa instead.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param callback body models.OIDCCallbackDTO true "Code and state from the redirect"
+// @Success 200 {object} models.LoginResponseDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/oidc/callback [post]
+func (controller *authController) OIDCCallback(ctx *gin.Context) {
+	var req models.OIDCCallbackDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := controller.service.OIDCCallback(ctx, req)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	respondLogin(ctx, token)
+}
+
+// LoginTwoFactor godoc
+// @Summary Second login step
+// @Description Exchanges the challenge token of /auth/login and a TOTP or recovery code for a JWT and a refresh token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param login body models.TwoFactorLoginDTO true "Challenge token and code"
+// @Success 200 {object} models.LoginResponseDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/login/2fa [post]
+func (controller *authController) LoginTwoFactor(ctx *gin.Context) {
+	var req models.TwoFactorLoginDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := controller.service.LoginTwoFactor(ctx, req)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
 	}
+	ctx.Set("Authorization", "Bearer "+token.Token)
+	serializers.JSON(ctx, http.StatusOK, serializers.Login(token))
+}
+
+// SetupTwoFactor godoc
+// @Summary Start two factor setup
+// @Description Generates a TOTP secret and its provisioning URI (QR payload). It is only active once confirmed with /auth/2fa/enable.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.TwoFactorSetupResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/2fa/setup [post]
+func (controller *authController) SetupTwoFactor(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+
+	setup, err := controller.service.SetupTwoFactor(ctx, userId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, setup)
+}
+
+// EnableTwoFactor godoc
+// @Summary Enable two factor authentication
+// @Description Confirms the setup with a current code and returns single use recovery codes, they are shown only once
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.TwoFactorCodeDTO true "TOTP code"
+// @Success 200 {object} models.TwoFactorEnableResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/2fa/enable [post]
+func (controller *authController) EnableTwoFactor(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+	var req models.TwoFactorCodeDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	enabled, err := controller.service.EnableTwoFactor(ctx, userId, req.Code)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, enabled)
+}
+
+// DisableTwoFactor godoc
+// @Summary Disable two factor authentication
+// @Description Removes the TOTP secret and the recovery codes, requires the password and a current or recovery code. Accounts created through single sign-on have no known password, they must set one with /auth/password/forgot first.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.TwoFactorDisableDTO true "Password and code"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/2fa/disable [post]
+func (controller *authController) DisableTwoFactor(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+	var req models.TwoFactorDisableDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := controller.service.DisableTwoFactor(ctx, userId, req); err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// RefreshTokenLogin godoc
+// @Summary Refresh login
+// @Description Exchanges a refresh token for a new JWT and a rotated refresh token. Presenting an already rotated token revokes the whole session and fails with code TOKEN_REUSED.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body models.ValidateRefreshTokenDTO true "Refresh token"
+// @Success 200 {object} models.LoginResponseDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/login/token [post]
+func (controller *authController) RefreshTokenLogin(ctx *gin.Context) {
+	var req models.ValidateRefreshTokenDTO
 	if err := ctx.BindJSON(&req); err != nil {
-		ctx.JSON(400, gin.H{"error": "error parsing request"})
+		serializers.JSON(ctx, 400, gin.H{"error": "error parsing request"})
 		return
 	}
 
-	validateRefreshTokenResponse, err := controller.service.ValidateRefreshToken(ctx, req.RefreshToken)
+	token, err := controller.service.RefreshSession(ctx, req.RefreshToken)
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": err.Error()})
+		respondRefreshError(ctx, err)
 		return
 	}
 
-	updatedRefreshToken, err := controller.service.UpdateRefreshToken(ctx, *validateRefreshTokenResponse.RefreshToken, validateRefreshTokenResponse.UserID.String())
+	ctx.Set("Authorization", "Bearer "+token.Token)
+	serializers.JSON(ctx, http.StatusOK, serializers.Login(token))
+}
+
+// Logout godoc
+// @Summary Logout
+// @Description Revokes the presented refresh token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body models.ValidateRefreshTokenDTO true "Refresh token to revoke"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/logout [post]
+func (controller *authController) Logout(ctx *gin.Context) {
+	var req models.ValidateRefreshTokenDTO
+	if err := ctx.BindJSON(&req); err != nil || req.RefreshToken == "" {
+		serializers.JSON(ctx, 400, gin.H{"error": "error parsing request"})
+		return
+	}
+
+	if err := controller.service.Logout(ctx, req.RefreshToken); err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
 
+// ListSessions godoc
+// @Summary List sessions
+// @Description Lists the active refresh tokens of the authenticated user, one per device
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.SessionDTO
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/sessions [get]
+func (controller *authController) ListSessions(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.Keys["userId"].(string))
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": "error updating refresh token ::" + err.Error()})
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
 		return
 	}
 
-	jwtKey := []byte(os.Getenv("JWT_SECRET"))
+	sessions, err := controller.service.ListSessions(ctx, userId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, sessions)
+}
 
-	/*
-		Generate JWT token -> 1 hour expiration
-	*/
-	claims := &models.JwtTokenClaims{
-		Email: *validateRefreshTokenResponse.UserEmail,
-		/* store userId, better for fetches latter */
-		ID: *validateRefreshTokenResponse.UserID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "daily-diet-backend",
-		},
+// RevokeSession godoc
+// @Summary Revoke session
+// @Description Revokes one refresh token of the authenticated user
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/sessions/{id} [delete]
+func (controller *authController) RevokeSession(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString(jwtKey)
+	sessionId, err := uuid.Parse(ctx.Param("id"))
 	if err != nil {
-		ctx.JSON(500, gin.H{"Jwt Sign Error": err.Error()})
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse session id"})
+		return
+	}
+
+	if err := controller.service.RevokeSession(ctx, userId, sessionId); err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// ForgotPassword godoc
+// @Summary Request password reset
+// @Description Emails a single use password reset link. Answers 202 whether the email is registered or not, 429 when the IP asked for too many resets. Repeated requests for one email within the resend interval or over the hourly limit are accepted but send nothing.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ForgotPasswordDTO true "Account email"
+// @Success 202 "Accepted"
+// @Failure 400 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Router /auth/password/forgot [post]
+func (controller *authController) ForgotPassword(ctx *gin.Context) {
+	var req models.ForgotPasswordDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.Set("Authorization", "Bearer "+signedToken)
-	ctx.JSON(http.StatusOK, gin.H{
-		"refresh_token": updatedRefreshToken.Token,
-		"jwt_token":     signedToken,
-		"user_email":    validateRefreshTokenResponse.UserEmail,
-		"user_id":       updatedRefreshToken.UserID,
+	req.ClientIP = ctx.ClientIP()
+
+	// only the per IP limit is reported, every other outcome looks the same
+	if err := controller.service.ForgotPassword(ctx, req); err != nil {
+		if errors.HTTPStatus(err) == http.StatusTooManyRequests {
+			serializers.JSON(ctx, http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		logger.Log(logger.ERROR, "Error sending password reset: "+err.Error())
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+// RequestMagicLink godoc
+// @Summary Request a login link
+// @Description Emails a single use, short lived login link bound to device_id. Answers 202 whether the email is registered or not, 429 when the IP asked for too many links.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.MagicLinkRequestDTO true "Account email and requesting device"
+// @Success 202 "Accepted"
+// @Failure 400 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Router /auth/magic-link [post]
+func (controller *authController) RequestMagicLink(ctx *gin.Context) {
+	var req models.MagicLinkRequestDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.ClientIP = ctx.ClientIP()
+
+	// only the per IP limit is reported, every other outcome looks the same
+	if err := controller.service.RequestMagicLink(ctx, req); err != nil {
+		if errors.HTTPStatus(err) == http.StatusTooManyRequests {
+			serializers.JSON(ctx, http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		logger.Log(logger.ERROR, "Error sending magic link: "+err.Error())
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+// ExchangeMagicLink godoc
+// @Summary Log in with a login link
+// @Description Exchanges the token of an emailed login link for a JWT and a refresh token. The device_id must be the one the link was requested with. When two factor authentication is enabled it returns a challenge_token for /auth/login/2fa instead.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.MagicLinkExchangeDTO true "Link token and device"
+// @Success 200 {object} models.LoginResponseDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/magic-link/exchange [post]
+func (controller *authController) ExchangeMagicLink(ctx *gin.Context) {
+	var req models.MagicLinkExchangeDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := controller.service.ExchangeMagicLink(ctx, req)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	respondLogin(ctx, token)
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Sets a new password using a reset token, signs out every session and deletes every personal access token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ResetPasswordDTO true "Reset token and new password"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/password/reset [post]
+func (controller *authController) ResetPassword(ctx *gin.Context) {
+	var req models.ResetPasswordDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := controller.service.ResetPassword(ctx, req); err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// VerifyEmail godoc
+// @Summary Verify email
+// @Description Confirms the email address of an account, or a pending email change which signs out the other sessions. The token is read from the query string (GET, emailed link) or the JSON body (POST).
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token query string false "Verification token (GET)"
+// @Param request body models.VerifyEmailDTO false "Verification token (POST)"
+// @Success 200 {object} models.UserDTO
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/verify [get]
+// @Router /auth/verify [post]
+func (controller *authController) VerifyEmail(ctx *gin.Context) {
+	var req models.VerifyEmailDTO
+	if err := ctx.ShouldBind(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := controller.service.VerifyEmail(ctx, req.Token)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, models.UserDTO{
+		Email: user.Email,
+		Name:  user.Name,
 	})
 }
+
+// ResendVerification godoc
+// @Summary Resend verification email
+// @Description Sends a new verification email. Always answers 202, unknown or verified emails and repeated requests are skipped silently.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ResendVerificationDTO true "Account email"
+// @Success 202 "Accepted"
+// @Failure 400 {object} map[string]string
+// @Router /auth/verify/resend [post]
+func (controller *authController) ResendVerification(ctx *gin.Context) {
+	var req models.ResendVerificationDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// same answer for every email, failures are only logged
+	if err := controller.service.ResendVerification(ctx, req.Email); err != nil {
+		logger.Log(logger.ERROR, "Error sending verification email: "+err.Error())
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+// respondRefreshError writes a refresh token error, reuse gets a distinct code
+// so clients can force the user back to the login screen
+func respondRefreshError(ctx *gin.Context, err error) {
+	if customErr, ok := err.(*errors.CustomError); ok && customErr.Type == errors.TokenReused {
+		serializers.JSON(ctx, http.StatusUnauthorized, gin.H{
+			"error": customErr.Message,
+			"code":  string(errors.TokenReused),
+		})
+		return
+	}
+	serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+}
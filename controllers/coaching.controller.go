@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"daily-diet-backend/middlewares"
+	"daily-diet-backend/models"
+	"daily-diet-backend/serializers"
+	"daily-diet-backend/services"
+	"daily-diet-backend/utils/errors"
+	"daily-diet-backend/utils/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type CoachingController interface {
+	ListRelationships(ctx *gin.Context)
+	Invite(ctx *gin.Context)
+	Accept(ctx *gin.Context)
+	Decline(ctx *gin.Context)
+	Revoke(ctx *gin.Context)
+	ListClientMeals(ctx *gin.Context)
+	GetClientStats(ctx *gin.Context)
+}
+
+type coachingController struct {
+	service services.CoachingService
+}
+
+func NewCoachingController(service services.CoachingService) CoachingController {
+	return &coachingController{service: service}
+}
+
+func RegisterCoachingRoutes(router *gin.RouterGroup, coachingService services.CoachingService, authService services.AuthService) {
+	coachingController := NewCoachingController(coachingService)
+	coachingRouter := router.Group("/coaching")
+
+	coachingRouter.Use(middlewares.AuthMiddleware(authService))
+	coachOnly := middlewares.RequireRole(models.RoleCoach)
+	logger.Log(logger.DEBUG, "Registering coaching routes")
+	{
+		coachingRouter.GET("", coachingController.ListRelationships)
+		coachingRouter.POST("/invitations", coachingController.Invite)
+		coachingRouter.POST("/:id/accept", coachOnly, coachingController.Accept)
+		coachingRouter.POST("/:id/decline", coachOnly, coachingController.Decline)
+		coachingRouter.DELETE("/:id", coachingController.Revoke)
+		coachingRouter.GET("/clients/:clientId/meals", coachOnly, coachingController.ListClientMeals)
+		coachingRouter.GET("/clients/:clientId/stats", coachOnly, coachingController.GetClientStats)
+	}
+}
+
+// parseCoachingParam reads the authenticated user id and a uuid path parameter
+func parseCoachingParam(ctx *gin.Context, param string) (uuid.UUID, uuid.UUID, bool) {
+	userId, err := uuid.Parse(ctx.GetString("userId"))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	value, err := uuid.Parse(ctx.Param(param))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse " + param})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userId, value, true
+}
+
+// ListRelationships godoc
+// @Summary List coaching relationships
+// @Description Lists the relationships of the authenticated user as client and as coach, including pending invitations
+// @Tags coaching
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.CoachClientDTO
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /coaching [get]
+func (controller *coachingController) ListRelationships(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.GetString("userId"))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+
+	relations, err := controller.service.ListRelationships(ctx, userId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, serializers.CoachClients(relations))
+}
+
+// Invite godoc
+// @Summary Invite a coach
+// @Description Invites a user with the coach role to read the meals and/or stats of the authenticated user
+// @Tags coaching
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CoachingInviteDTO true "Coach email and granted scopes"
+// @Success 201 {object} models.CoachClientDTO
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /coaching/invitations [post]
+func (controller *coachingController) Invite(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.GetString("userId"))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+	var req models.CoachingInviteDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	relation, err := controller.service.Invite(ctx, userId, req)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusCreated, serializers.CoachClient(relation))
+}
+
+// Accept godoc
+// @Summary Accept an invitation
+// @Description Accepts a pending invitation sent to the authenticated coach
+// @Tags coaching
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Relationship ID"
+// @Success 200 {object} models.CoachClientDTO
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /coaching/{id}/accept [post]
+func (controller *coachingController) Accept(ctx *gin.Context) {
+	userId, relationId, ok := parseCoachingParam(ctx, "id")
+	if !ok {
+		return
+	}
+
+	relation, err := controller.service.Accept(ctx, relationId, userId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, serializers.CoachClient(relation))
+}
+
+// Decline godoc
+// @Summary Decline an invitation
+// @Description Declines a pending invitation sent to the authenticated coach
+// @Tags coaching
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Relationship ID"
+// @Success 200 {object} models.CoachClientDTO
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /coaching/{id}/decline [post]
+func (controller *coachingController) Decline(ctx *gin.Context) {
+	userId, relationId, ok := parseCoachingParam(ctx, "id")
+	if !ok {
+		return
+	}
+
+	relation, err := controller.service.Decline(ctx, relationId, userId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, serializers.CoachClient(relation))
+}
+
+// Revoke godoc
+// @Summary Revoke a relationship
+// @Description Ends a pending or active relationship, the client or the coach can revoke it
+// @Tags coaching
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Relationship ID"
+// @Success 200 {object} models.CoachClientDTO
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /coaching/{id} [delete]
+func (controller *coachingController) Revoke(ctx *gin.Context) {
+	userId, relationId, ok := parseCoachingParam(ctx, "id")
+	if !ok {
+		return
+	}
+
+	relation, err := controller.service.Revoke(ctx, relationId, userId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, serializers.CoachClient(relation))
+}
+
+// ListClientMeals godoc
+// @Summary List a client's meals
+// @Description Lists the meals of a client who granted the meals:read scope, with the filters of /meals/list
+// @Tags coaching
+// @Produce json
+// @Security BearerAuth
+// @Param clientId path string true "Client user ID"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param from query string false "First day to include (YYYY-MM-DD)"
+// @Param to query string false "Last day to include (YYYY-MM-DD)"
+// @Param in_diet query bool false "Filter by in diet flag"
+// @Param name query string false "Case insensitive name substring"
+// @Param sort_by query string false "date or created_at (default date)"
+// @Param order query string false "asc or desc (default desc)"
+// @Success 200 {object} models.ListMealsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /coaching/clients/{clientId}/meals [get]
+func (controller *coachingController) ListClientMeals(ctx *gin.Context) {
+	userId, clientId, ok := parseCoachingParam(ctx, "clientId")
+	if !ok {
+		return
+	}
+	var query models.ListMealsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	meals, err := controller.service.ListClientMeals(ctx, userId, clientId, query)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, serializers.MealsPage(meals))
+}
+
+// GetClientStats godoc
+// @Summary Get a client's statistics
+// @Description Retrieves the statistics of a client who granted the stats:read scope
+// @Tags coaching
+// @Produce json
+// @Security BearerAuth
+// @Param clientId path string true "Client user ID"
+// @Success 200 {object} models.UserStatsDTO
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /coaching/clients/{clientId}/stats [get]
+func (controller *coachingController) GetClientStats(ctx *gin.Context) {
+	userId, clientId, ok := parseCoachingParam(ctx, "clientId")
+	if !ok {
+		return
+	}
+
+	stats, err := controller.service.GetClientStats(ctx, userId, clientId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, serializers.UserStats(stats))
+}
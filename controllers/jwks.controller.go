@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"daily-diet-backend/serializers"
+	"daily-diet-backend/services"
+	"daily-diet-backend/utils/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSController interface {
+	GetJWKS(ctx *gin.Context)
+}
+
+type jwksController struct {
+	keys services.KeyManager
+}
+
+func NewJWKSController(keys services.KeyManager) JWKSController {
+	return &jwksController{keys: keys}
+}
+
+// RegisterJWKSRoutes publishes the token verification keys, router is the
+// /.well-known group outside of /v1
+func RegisterJWKSRoutes(router *gin.RouterGroup, keys services.KeyManager) {
+	jwksController := NewJWKSController(keys)
+	logger.Log(logger.DEBUG, "Registering jwks routes")
+	{
+		router.GET("/jwks.json", jwksController.GetJWKS)
+	}
+}
+
+// GetJWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys access tokens are verified with, selected by the kid header of a token
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.JWKSet
+// @Router /.well-known/jwks.json [get]
+func (controller *jwksController) GetJWKS(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	serializers.JSON(ctx, http.StatusOK, controller.keys.JWKS())
+}
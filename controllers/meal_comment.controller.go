@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"daily-diet-backend/middlewares"
+	"daily-diet-backend/models"
+	"daily-diet-backend/repositories"
+	"daily-diet-backend/serializers"
+	"daily-diet-backend/services"
+	"daily-diet-backend/utils/errors"
+	"daily-diet-backend/utils/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type MealCommentController interface {
+	ListComments(ctx *gin.Context)
+	CreateComment(ctx *gin.Context)
+}
+
+type mealCommentController struct {
+	service services.MealCommentService
+}
+
+func NewMealCommentController(service services.MealCommentService) MealCommentController {
+	return &mealCommentController{service: service}
+}
+
+func RegisterMealCommentRoutes(router *gin.RouterGroup, client *gorm.DB, authService services.AuthService) {
+	commentService := services.NewMealCommentService(repositories.NewMealCommentRepository(client))
+	commentController := NewMealCommentController(commentService)
+	commentsRouter := router.Group("/meals/:mealId/comments")
+
+	logger.Log(logger.DEBUG, "Registering meal comment routes")
+	{
+		commentsRouter.GET("", middlewares.AuthMiddleware(authService, models.ScopeMealsRead), commentController.ListComments)
+		commentsRouter.POST("", middlewares.AuthMiddleware(authService, models.ScopeMealsWrite), commentController.CreateComment)
+	}
+}
+
+// ListComments godoc
+// @Summary List the comments of a meal
+// @Description Lists the comments of a meal oldest first, readable by the owner and their coaches. Comments are marked as read when the owner lists them
+// @Tags meals
+// @Produce json
+// @Security BearerAuth
+// @Param mealId path string true "Meal ID"
+// @Success 200 {array} models.MealCommentDTO
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /meals/{mealId}/comments [get]
+func (controller *mealCommentController) ListComments(ctx *gin.Context) {
+	parsedUserId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+
+	comments, err := controller.service.ListComments(ctx, ctx.Param("mealId"), parsedUserId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, 200, serializers.MealComments(comments))
+}
+
+// CreateComment godoc
+// @Summary Comment on a meal
+// @Description Adds a comment to a meal as its owner or as a coach of the owner. A coach granted meals:verdict can add a verdict, it wins over the in_diet flag of the owner. A null verdict clears it, the owner can clear it too
+// @Tags meals
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param mealId path string true "Meal ID"
+// @Param comment body models.CreateMealCommentDTO true "Comment"
+// @Success 201 {object} models.MealCommentDTO
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /meals/{mealId}/comments [post]
+func (controller *mealCommentController) CreateComment(ctx *gin.Context) {
+	parsedUserId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+	var req models.CreateMealCommentDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	comment, err := controller.service.CreateComment(ctx, ctx.Param("mealId"), parsedUserId, req)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, 201, serializers.MealComment(comment))
+}
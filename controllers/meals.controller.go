@@ -4,7 +4,9 @@ import (
 	"daily-diet-backend/middlewares"
 	"daily-diet-backend/models"
 	"daily-diet-backend/repositories"
+	"daily-diet-backend/serializers"
 	"daily-diet-backend/services"
+	"daily-diet-backend/utils/errors"
 	"daily-diet-backend/utils/logger"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +20,10 @@ type MealsController interface {
 	GetMeals(ctx *gin.Context)
 	DeleteMeal(ctx *gin.Context)
 	GetMeal(ctx *gin.Context)
+	GetTimeline(ctx *gin.Context)
+	ListTags(ctx *gin.Context)
+	GetDailyTotals(ctx *gin.Context)
+	GetWeeklyTotals(ctx *gin.Context)
 }
 
 type mealsController struct {
@@ -34,14 +40,20 @@ func RegisteredMealsRoutes(router *gin.RouterGroup, client *gorm.DB, authService
 	mealsController := NewMealsController(mealsService)
 	mealsRouter := router.Group("/meals")
 
-	mealsRouter.Use(middlewares.AuthMiddleware(authService))
+	// personal access tokens need the matching scope
+	canRead := middlewares.AuthMiddleware(authService, models.ScopeMealsRead)
+	canWrite := middlewares.AuthMiddleware(authService, models.ScopeMealsWrite)
 	logger.Log(logger.DEBUG, "Registering auth routes")
 	{
-		mealsRouter.POST("/new", mealsController.CreateMeal)
-		mealsRouter.GET("/list", mealsController.GetMeals)
-		mealsRouter.PATCH("edit/:mealId", mealsController.EditMeal)
-		mealsRouter.DELETE("delete/:mealId", mealsController.DeleteMeal)
-		mealsRouter.GET("/:mealId", mealsController.GetMeal)
+		mealsRouter.POST("/new", canWrite, middlewares.RequireVerifiedEmail(authService), mealsController.CreateMeal)
+		mealsRouter.GET("/list", canRead, mealsController.GetMeals)
+		mealsRouter.GET("/timeline", canRead, mealsController.GetTimeline)
+		mealsRouter.GET("/tags", canRead, mealsController.ListTags)
+		mealsRouter.GET("/totals/daily", canRead, mealsController.GetDailyTotals)
+		mealsRouter.GET("/totals/weekly", canRead, mealsController.GetWeeklyTotals)
+		mealsRouter.PATCH("edit/:mealId", canWrite, mealsController.EditMeal)
+		mealsRouter.DELETE("delete/:mealId", canWrite, mealsController.DeleteMeal)
+		mealsRouter.GET("/:mealId", canRead, mealsController.GetMeal)
 	}
 }
 
@@ -53,7 +65,7 @@ func RegisteredMealsRoutes(router *gin.RouterGroup, client *gorm.DB, authService
 // @Produce json
 // @Security BearerAuth
 // @Param meal body models.CreateMealDTO true "Meal details"
-// @Success 201 {object} models.Meal
+// @Success 201 {object} models.GetMealDTO
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /meals/new [post]
@@ -61,7 +73,7 @@ func (controller *mealsController) CreateMeal(ctx *gin.Context) {
 	userId := ctx.Keys["userId"].(string)
 	parsedUserId, err := uuid.Parse(userId)
 	if err != nil {
-		ctx.JSON(400, gin.H{"error": "could not parse userId"})
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
 		return
 	}
 	var req models.CreateMealDTO
@@ -69,64 +81,76 @@ func (controller *mealsController) CreateMeal(ctx *gin.Context) {
 
 	if err := ctx.BindJSON(&req); err != nil {
 		logger.Log(logger.ERROR, err.Error())
-		ctx.JSON(400, gin.H{"error": err.Error()})
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
 		return
 	}
 	meal, err := controller.service.CreateMeal(ctx, req, parsedUserId)
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": err.Error()})
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	ctx.JSON(201, meal)
+	serializers.JSON(ctx, 201, serializers.Meal(meal))
 }
 
 // EditMeal godoc
 // @Summary Edit an existing meal
-// @Description Modifies an existing meal for the authenticated user
+// @Description Modifies an existing meal for the authenticated user, omitted fields are kept and clear_macros removes nutrition facts
 // @Tags meals
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param mealId path string true "Meal ID"
 // @Param meal body models.EditMealDTO true "Updated meal details"
-// @Success 200 {object} models.Meal
+// @Success 200 {object} models.GetMealDTO
 // @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /meals/edit/{mealId} [patch]
 func (controller *mealsController) EditMeal(ctx *gin.Context) {
 	userId := ctx.Keys["userId"].(string)
 	parsedUserId, err := uuid.Parse(userId)
 	if err != nil {
-		ctx.JSON(400, gin.H{"error": "could not parse userId"})
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
 		return
 	}
 	mealId := ctx.Param("mealId")
 	if mealId == "" {
-		ctx.JSON(400, gin.H{"error": "mealId not found"})
+		serializers.JSON(ctx, 400, gin.H{"error": "mealId not found"})
 		return
 	}
 	var req models.EditMealDTO
 	if err := ctx.BindJSON(&req); err != nil {
 		logger.Log(logger.ERROR, err.Error())
-		ctx.JSON(400, gin.H{"error": err.Error()})
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
 		return
 	}
 	meal, err := controller.service.EditMeal(ctx, mealId, parsedUserId, req)
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": err.Error()})
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	ctx.JSON(200, meal)
+	serializers.JSON(ctx, 200, serializers.Meal(meal))
 }
 
 // GetMeals godoc
-// @Summary List all meals
-// @Description Retrieves all meals for the authenticated user
+// @Summary List meals
+// @Description Retrieves a page of meals for the authenticated user, optionally filtered and sorted
 // @Tags meals
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {array} models.Meal
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param from query string false "First day to include (YYYY-MM-DD)"
+// @Param to query string false "Last day to include (YYYY-MM-DD)"
+// @Param in_diet query bool false "Filter by in diet flag"
+// @Param name query string false "Case insensitive name substring"
+// @Param meal_type query string false "breakfast, lunch, dinner or snack"
+// @Param tag query []string false "Tag names, repeat for several" collectionFormat(multi)
+// @Param tag_match query string false "any (default) or all of the tags"
+// @Param sort_by query string false "date or created_at (default date)"
+// @Param order query string false "asc or desc (default desc)"
+// @Success 200 {object} models.ListMealsResponse
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /meals/list [get]
@@ -134,20 +158,26 @@ func (controller *mealsController) GetMeals(ctx *gin.Context) {
 	userId := ctx.Keys["userId"].(string)
 	parsedUserId, err := uuid.Parse(userId)
 	if err != nil {
-		ctx.JSON(400, gin.H{"error": "could not parse userId"})
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
 		return
 	}
 	if userId == "" {
-		ctx.JSON(404, gin.H{"error": "userId not found"})
+		serializers.JSON(ctx, 404, gin.H{"error": "userId not found"})
 		return
 	}
 
-	meals, err := controller.service.GetMeals(ctx, parsedUserId)
+	var query models.ListMealsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	meals, err := controller.service.GetMeals(ctx, parsedUserId, query)
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": err.Error()})
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	ctx.JSON(200, meals)
+	serializers.JSON(ctx, 200, serializers.MealsPage(meals))
 }
 
 // DeleteMeal godoc
@@ -160,55 +190,170 @@ func (controller *mealsController) GetMeals(ctx *gin.Context) {
 // @Param mealId path string true "Meal ID"
 // @Success 204 "No Content"
 // @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /meals/delete/{mealId} [delete]
 func (controller *mealsController) DeleteMeal(ctx *gin.Context) {
 	userId := ctx.Keys["userId"].(string)
 	parsedUserId, err := uuid.Parse(userId)
 	if err != nil {
-		ctx.JSON(400, gin.H{"error": "could not parse userId"})
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
 		return
 	}
 	mealId := ctx.Param("mealId")
 	if mealId == "" {
-		ctx.JSON(400, gin.H{"error": "mealId not found"})
+		serializers.JSON(ctx, 400, gin.H{"error": "mealId not found"})
 		return
 	}
 
 	err = controller.service.DeleteMeal(ctx, mealId, parsedUserId)
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": err.Error()})
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	ctx.JSON(204, nil)
+	serializers.JSON(ctx, 204, nil)
 }
 
 func (controller *mealsController) GetMeal(ctx *gin.Context) {
 	userId := ctx.Keys["userId"].(string)
 	parsedUserId, err := uuid.Parse(userId)
 	if err != nil {
-		ctx.JSON(400, gin.H{"error": "could not parse userId"})
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
 		return
 	}
 	mealId := ctx.Param("mealId")
 	if mealId == "" {
-		ctx.JSON(400, gin.H{"error": "mealId not found"})
+		serializers.JSON(ctx, 400, gin.H{"error": "mealId not found"})
 		return
 	}
 
 	meal, err := controller.service.GetMeal(ctx, mealId, parsedUserId)
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": err.Error()})
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	ctx.JSON(200, gin.H{
-		"meal": &models.GetMealDTO{
-			ID:          meal.ID,
-			Name:        meal.Name,
-			Description: meal.Description,
-			Date:        meal.Date,
-			Time:        meal.Time,
-			InDiet:      meal.InDiet,
-		},
+	serializers.JSON(ctx, 200, gin.H{
+		"meal": serializers.Meal(meal),
 	})
 }
+
+// GetTimeline godoc
+// @Summary List meals grouped by day
+// @Description Retrieves pages of days, most recent first, each with its meals ordered by time and in diet totals
+// @Tags meals
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param limit query int false "Days per page (default 20, max 100)"
+// @Success 200 {object} models.TimelineResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /meals/timeline [get]
+func (controller *mealsController) GetTimeline(ctx *gin.Context) {
+	userId := ctx.Keys["userId"].(string)
+	parsedUserId, err := uuid.Parse(userId)
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+
+	var query models.TimelineQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	timeline, err := controller.service.GetTimeline(ctx, parsedUserId, query)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, 200, serializers.Timeline(timeline))
+}
+
+// ListTags godoc
+// @Summary Autocomplete tags
+// @Description Lists the tags of the authenticated user used on at least one meal, most used first
+// @Tags meals
+// @Produce json
+// @Security BearerAuth
+// @Param q query string false "Tag name prefix"
+// @Param limit query int false "Maximum tags (default 20, max 100)"
+// @Success 200 {array} models.TagDTO
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /meals/tags [get]
+func (controller *mealsController) ListTags(ctx *gin.Context) {
+	parsedUserId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+
+	var query models.ListTagsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	tags, err := controller.service.ListTags(ctx, parsedUserId, query)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, 200, serializers.Tags(tags))
+}
+
+// GetDailyTotals godoc
+// @Summary Nutrition totals per day
+// @Description Sums calories, protein, carbs, fat and fiber of the meals of each day, days without meals included
+// @Tags meals
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "First day (YYYY-MM-DD, default 6 days before to)"
+// @Param to query string false "Last day (YYYY-MM-DD, default today)"
+// @Success 200 {object} models.MacroTotalsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /meals/totals/daily [get]
+func (controller *mealsController) GetDailyTotals(ctx *gin.Context) {
+	controller.getMacroTotals(ctx, models.MacroPeriodDay)
+}
+
+// GetWeeklyTotals godoc
+// @Summary Nutrition totals per week
+// @Description Sums calories, protein, carbs, fat and fiber of the meals of each week starting on Monday, weeks without meals included
+// @Tags meals
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "A day of the first week (YYYY-MM-DD, default 7 weeks before to)"
+// @Param to query string false "Last day (YYYY-MM-DD, default today)"
+// @Success 200 {object} models.MacroTotalsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /meals/totals/weekly [get]
+func (controller *mealsController) GetWeeklyTotals(ctx *gin.Context) {
+	controller.getMacroTotals(ctx, models.MacroPeriodWeek)
+}
+
+func (controller *mealsController) getMacroTotals(ctx *gin.Context, period string) {
+	parsedUserId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+
+	var query models.MacroTotalsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	totals, err := controller.service.GetMacroTotals(ctx, parsedUserId, period, query)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, 200, serializers.MacroTotals(period, totals))
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/repositories"
+	"daily-diet-backend/services"
+	"daily-diet-backend/utils/errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// stubMealsRepository answers EditMeal with meal or err, the other methods
+// are not used
+type stubMealsRepository struct {
+	repositories.MealsRepository
+	meal   *models.Meal
+	err    error
+	called bool
+}
+
+func (repo *stubMealsRepository) EditMeal(
+	c context.Context,
+	mealId string,
+	userId uuid.UUID,
+	data models.EditMealDTO,
+) (*models.Meal, error) {
+	repo.called = true
+	return repo.meal, repo.err
+}
+
+func TestEditMealStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userId := uuid.New()
+
+	tests := []struct {
+		name       string
+		body       string
+		repo       *stubMealsRepository
+		wantStatus int
+		wantCalled bool
+	}{
+		{
+			"edited",
+			`{"name": "Salad", "clear_macros": ["fat"]}`,
+			&stubMealsRepository{meal: &models.Meal{ID: uuid.New(), UserID: userId, Name: "Salad"}},
+			http.StatusOK,
+			true,
+		},
+		{
+			"macro set and cleared",
+			`{"fat": 12, "clear_macros": ["fat"]}`,
+			&stubMealsRepository{},
+			http.StatusBadRequest,
+			false,
+		},
+		{
+			"unknown macro",
+			`{"clear_macros": ["sugar"]}`,
+			&stubMealsRepository{},
+			http.StatusBadRequest,
+			false,
+		},
+		{
+			"meal not found",
+			`{"name": "Salad"}`,
+			&stubMealsRepository{err: errors.NewError(errors.NotFound, "no meal", nil)},
+			http.StatusNotFound,
+			true,
+		},
+		{
+			"database failure",
+			`{"name": "Salad"}`,
+			&stubMealsRepository{err: errors.NewError(errors.Internal, "error updating meal", nil)},
+			http.StatusInternalServerError,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			controller := NewMealsController(services.NewMealsService(test.repo))
+			router := gin.New()
+			router.PATCH("/meals/edit/:mealId", func(ctx *gin.Context) {
+				ctx.Set("userId", userId.String())
+			}, controller.EditMeal)
+
+			request := httptest.NewRequest(http.MethodPatch, "/meals/edit/"+uuid.NewString(), strings.NewReader(test.body))
+			request.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d (%s)", recorder.Code, test.wantStatus, recorder.Body)
+			}
+			if test.repo.called != test.wantCalled {
+				t.Errorf("repository called = %v, want %v", test.repo.called, test.wantCalled)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"daily-diet-backend/middlewares"
+	"daily-diet-backend/models"
+	"daily-diet-backend/serializers"
+	"daily-diet-backend/services"
+	"daily-diet-backend/utils/errors"
+	"daily-diet-backend/utils/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type UsersController interface {
+	GetMe(ctx *gin.Context)
+	UpdateMe(ctx *gin.Context)
+	ChangePassword(ctx *gin.Context)
+	DeleteMe(ctx *gin.Context)
+	ExportMe(ctx *gin.Context)
+	ListTokens(ctx *gin.Context)
+	CreateToken(ctx *gin.Context)
+	RevokeToken(ctx *gin.Context)
+}
+
+type usersController struct {
+	service services.UsersService
+}
+
+func NewUsersController(service services.UsersService) UsersController {
+	return &usersController{service: service}
+}
+
+func RegisterUsersRoutes(router *gin.RouterGroup, usersService services.UsersService, authService services.AuthService) {
+	usersController := NewUsersController(usersService)
+	usersRouter := router.Group("/users")
+
+	usersRouter.Use(middlewares.AuthMiddleware(authService))
+	logger.Log(logger.DEBUG, "Registering users routes")
+	{
+		usersRouter.GET("/me", usersController.GetMe)
+		usersRouter.PATCH("/me", usersController.UpdateMe)
+		usersRouter.POST("/me/password", usersController.ChangePassword)
+		usersRouter.DELETE("/me", usersController.DeleteMe)
+		usersRouter.GET("/me/export", usersController.ExportMe)
+		usersRouter.GET("/me/tokens", usersController.ListTokens)
+		usersRouter.POST("/me/tokens", usersController.CreateToken)
+		usersRouter.DELETE("/me/tokens/:id", usersController.RevokeToken)
+	}
+}
+
+// GetMe godoc
+// @Summary Get profile
+// @Description Retrieves the profile of the authenticated user
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.UserProfileDTO
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/me [get]
+func (controller *usersController) GetMe(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+
+	user, err := controller.service.GetProfile(ctx, userId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, serializers.UserProfile(user))
+}
+
+// UpdateMe godoc
+// @Summary Update profile
+// @Description Changes the name and/or email of the authenticated user. A new email needs current_password and is kept as pending_email until confirmed through the link sent to it, the current address is notified. Sending the current email cancels a pending change. Accounts created through single sign-on have no known password, they must set one with /auth/password/forgot first.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param user body models.UpdateUserDTO true "Fields to update"
+// @Success 200 {object} models.UserProfileDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/me [patch]
+func (controller *usersController) UpdateMe(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+	var req models.UpdateUserDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the session asking for an email change stays signed in once it is confirmed
+	var currentSessionId *uuid.UUID
+	if sessionId, err := uuid.Parse(ctx.GetString("sessionId")); err == nil {
+		currentSessionId = &sessionId
+	}
+
+	user, err := controller.service.UpdateProfile(ctx, userId, req, currentSessionId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, serializers.UserProfile(user))
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Changes the password of the authenticated user, signs out every other session and deletes every personal access token. Accounts created through single sign-on have no known password, they must set one with /auth/password/forgot first.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param password body models.ChangePasswordDTO true "Current and new password"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/me/password [post]
+func (controller *usersController) ChangePassword(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+	var req models.ChangePasswordDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// keep the session the request was made from
+	var currentSessionId *uuid.UUID
+	if sessionId, err := uuid.Parse(ctx.GetString("sessionId")); err == nil {
+		currentSessionId = &sessionId
+	}
+
+	if err := controller.service.ChangePassword(ctx, userId, req, currentSessionId); err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// DeleteMe godoc
+// @Summary Delete account
+// @Description Schedules the account for deletion after a grace period and signs out every session. Logging in again before the date cancels the deletion. Requires the password. Accounts created through single sign-on have no known password, they must set one with /auth/password/forgot first.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.DeleteAccountDTO true "Password confirmation"
+// @Success 202 {object} models.DeleteAccountResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/me [delete]
+func (controller *usersController) DeleteMe(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+	var req models.DeleteAccountDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	deleteAt, err := controller.service.DeleteAccount(ctx, userId, req)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusAccepted, models.DeleteAccountResponse{
+		DeletionScheduledAt: *deleteAt,
+	})
+}
+
+// ExportMe godoc
+// @Summary Export personal data
+// @Description Returns the profile, meals, stats and sessions of the authenticated user as a JSON bundle or a ZIP archive
+// @Tags users
+// @Produce json
+// @Produce application/zip
+// @Security BearerAuth
+// @Param format query string false "json (default) or zip"
+// @Success 200 {object} models.UserExportDTO
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/me/export [get]
+func (controller *usersController) ExportMe(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+	format := ctx.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		serializers.JSON(ctx, 400, gin.H{"error": "format must be json or zip"})
+		return
+	}
+
+	export, err := controller.service.ExportData(ctx, userId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	bundle := serializers.UserExport(export)
+
+	if format == "zip" {
+		serializers.ZIP(ctx, "daily-diet-export.zip", map[string]any{
+			"profile.json":  bundle.Profile,
+			"meals.json":    bundle.Meals,
+			"stats.json":    bundle.Stats,
+			"sessions.json": bundle.Sessions,
+		})
+		return
+	}
+	ctx.Header("Content-Disposition", `attachment; filename="daily-diet-export.json"`)
+	serializers.JSON(ctx, http.StatusOK, bundle)
+}
+
+// ListTokens godoc
+// @Summary List personal access tokens
+// @Description Lists the personal access tokens of the authenticated user, without their values
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.PersonalAccessTokenDTO
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/me/tokens [get]
+func (controller *usersController) ListTokens(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+
+	tokens, err := controller.service.ListAccessTokens(ctx, userId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusOK, serializers.PersonalAccessTokens(tokens))
+}
+
+// CreateToken godoc
+// @Summary Create personal access token
+// @Description Creates a scoped token for scripts, sent as Bearer token like a JWT. The value is only returned once.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param token body models.CreatePersonalAccessTokenDTO true "Name, scopes and lifetime"
+// @Success 201 {object} models.CreatedPersonalAccessTokenDTO
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/me/tokens [post]
+func (controller *usersController) CreateToken(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+	var req models.CreatePersonalAccessTokenDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := controller.service.CreateAccessToken(ctx, userId, req)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, http.StatusCreated, models.CreatedPersonalAccessTokenDTO{
+		PersonalAccessTokenDTO: serializers.PersonalAccessToken(token),
+		Token:                  token.Token,
+	})
+}
+
+// RevokeToken godoc
+// @Summary Revoke personal access token
+// @Description Deletes a personal access token of the authenticated user
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Token ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/me/tokens/{id} [delete]
+func (controller *usersController) RevokeToken(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse userId"})
+		return
+	}
+	tokenId, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "could not parse token id"})
+		return
+	}
+
+	if err := controller.service.RevokeAccessToken(ctx, userId, tokenId); err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
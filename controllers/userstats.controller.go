@@ -2,8 +2,11 @@ package controllers
 
 import (
 	"daily-diet-backend/middlewares"
+	"daily-diet-backend/models"
 	"daily-diet-backend/repositories"
+	"daily-diet-backend/serializers"
 	"daily-diet-backend/services"
+	"daily-diet-backend/utils/errors"
 	"daily-diet-backend/utils/logger"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +16,7 @@ import (
 
 type UserStatsController interface {
 	GetStats(ctx *gin.Context)
+	GetMealTypeStats(ctx *gin.Context)
 }
 
 type userStatsController struct {
@@ -25,10 +29,11 @@ func RegisterUserStatsRoutes(router *gin.RouterGroup, client *gorm.DB, authServi
 	userStatsController := NewUserStatsController(userStatsService)
 	userStatsRouter := router.Group("/userstats")
 
-	userStatsRouter.Use(middlewares.AuthMiddleware(authService))
+	userStatsRouter.Use(middlewares.AuthMiddleware(authService, models.ScopeStatsRead))
 	logger.Log(logger.DEBUG, "Registering auth routes")
 	{
 		userStatsRouter.GET("/find", userStatsController.GetStats)
+		userStatsRouter.GET("/meal-types", userStatsController.GetMealTypeStats)
 	}
 }
 func NewUserStatsController(service services.UserStatsService) UserStatsController {
@@ -48,13 +53,37 @@ func (controller *userStatsController) GetStats(ctx *gin.Context) {
 	userId := ctx.Keys["userId"]
 	parserId, err := uuid.Parse(userId.(string))
 	if err != nil {
-		ctx.JSON(400, gin.H{"error": "Error parsing userId"})
+		serializers.JSON(ctx, 400, gin.H{"error": "Error parsing userId"})
 		return
 	}
 	stats, err := controller.service.GetStats(ctx, parserId)
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": "Internal server error"})
+		serializers.JSON(ctx, 500, gin.H{"error": "Internal server error"})
 		return
 	}
-	ctx.JSON(200, stats)
+	serializers.JSON(ctx, 200, serializers.UserStats(stats))
+}
+
+// GetMealTypeStats godoc
+// @Summary In diet share per meal type
+// @Description Counts the meals of each type (breakfast, lunch, dinner, snack) and the percentage of them in diet
+// @Tags userstats
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.MealTypeStatsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /userstats/meal-types [get]
+func (controller *userStatsController) GetMealTypeStats(ctx *gin.Context) {
+	parsedUserId, err := uuid.Parse(ctx.Keys["userId"].(string))
+	if err != nil {
+		serializers.JSON(ctx, 400, gin.H{"error": "Error parsing userId"})
+		return
+	}
+	stats, err := controller.service.GetMealTypeStats(ctx, parsedUserId)
+	if err != nil {
+		serializers.JSON(ctx, errors.HTTPStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	serializers.JSON(ctx, 200, serializers.MealTypeStats(stats))
 }
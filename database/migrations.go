@@ -0,0 +1,132 @@
+package database
+
+import (
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/crypt"
+	"daily-diet-backend/utils/logger"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MigrateRefreshTokenHashes converts refresh_tokens rows created when the plain
+// token was the primary key: the token is replaced by its keyed hash and the
+// id column becomes the primary key. It must run before AutoMigrate and is a
+// no-op once the plain token column is gone.
+func MigrateRefreshTokenHashes(db *gorm.DB, hashKey []byte) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable("refresh_tokens") || !migrator.HasColumn("refresh_tokens", "token") {
+		return nil
+	}
+	logger.Log(logger.INFO, "Hashing plaintext refresh tokens...")
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			"ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS token_hash varchar(64)",
+			"ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS id uuid DEFAULT uuid_generate_v4()",
+			"UPDATE refresh_tokens SET id = uuid_generate_v4() WHERE id IS NULL",
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		var plainTokens []string
+		if err := tx.Table("refresh_tokens").Where("token_hash IS NULL").Pluck("token", &plainTokens).Error; err != nil {
+			return err
+		}
+		for _, token := range plainTokens {
+			if err := tx.Exec(
+				"UPDATE refresh_tokens SET token_hash = ? WHERE token = ?",
+				crypt.HashToken(hashKey, token), token,
+			).Error; err != nil {
+				return err
+			}
+		}
+
+		statements = []string{
+			"ALTER TABLE refresh_tokens ALTER COLUMN token_hash SET NOT NULL",
+			"ALTER TABLE refresh_tokens DROP CONSTRAINT IF EXISTS refresh_tokens_pkey",
+			"DROP INDEX IF EXISTS idx_refresh_tokens_id",
+			"ALTER TABLE refresh_tokens ADD PRIMARY KEY (id)",
+			"ALTER TABLE refresh_tokens DROP COLUMN token",
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		logger.Log(logger.INFO, "Hashed "+strconv.Itoa(len(plainTokens))+" refresh tokens")
+		return nil
+	})
+}
+
+// MigrateMealTypes adds the meal_type column to existing meals, inferred from
+// the hour of the meal like models.InferMealType. Stored times lost the offset
+// the client sent, so their hour is read in timeZone (an IANA name such as
+// "Europe/Paris"). It must run before AutoMigrate and is a no-op once the
+// column exists.
+func MigrateMealTypes(db *gorm.DB, timeZone string) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable("meals") || migrator.HasColumn("meals", "meal_type") {
+		return nil
+	}
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		return fmt.Errorf("invalid meal type time zone %q: %w", timeZone, err)
+	}
+	logger.Log(logger.INFO, "Inferring meal types of existing meals in "+timeZone+"...")
+
+	hour := "EXTRACT(HOUR FROM time)"
+	cases := make([]string, 0, len(models.MealTypeWindows))
+	for _, window := range models.MealTypeWindows {
+		cases = append(cases, "WHEN "+hour+" >= "+strconv.Itoa(window.From)+
+			" AND "+hour+" < "+strconv.Itoa(window.To)+
+			" THEN '"+window.MealType+"'")
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		// EXTRACT reads the hour in the time zone of the transaction
+		if err := tx.Exec("SELECT set_config('TimeZone', ?, true)", timeZone).Error; err != nil {
+			return err
+		}
+		statements := []string{
+			"ALTER TABLE meals ADD COLUMN meal_type varchar(16)",
+			"UPDATE meals SET meal_type = CASE " + strings.Join(cases, " ") + " ELSE '" + models.MealTypeSnack + "' END",
+			"ALTER TABLE meals ALTER COLUMN meal_type SET NOT NULL",
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateVerifiedAt adds the verified_at column to existing users, who
+// registered before email verification existed and are treated as verified
+// so an unverified user policy does not lock them out. It must run before
+// AutoMigrate and is a no-op once the column exists.
+func MigrateVerifiedAt(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable("users") || migrator.HasColumn("users", "verified_at") {
+		return nil
+	}
+	logger.Log(logger.INFO, "Marking existing users as verified...")
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			"ALTER TABLE users ADD COLUMN verified_at timestamptz",
+			"UPDATE users SET verified_at = COALESCE(created_at, now())",
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -5,15 +5,21 @@ import (
 	"daily-diet-backend/database"
 	_ "daily-diet-backend/docs"
 	"daily-diet-backend/models"
+	"daily-diet-backend/repositories"
 	"daily-diet-backend/router"
+	"daily-diet-backend/utils/config"
 	"daily-diet-backend/utils/logger"
 	"daily-diet-backend/utils/seed"
 	"daily-diet-backend/utils/validators"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -48,18 +54,107 @@ func main() {
 	// Close connection when main function ends
 	defer sqlDB.Close()
 
+	// CLI commands: go run main.go <command>
+	if len(os.Args) > 1 {
+		runCommand(db, os.Args[1])
+		return
+	}
+
 	initServer(db)
 }
 
-func initServer(db *gorm.DB) {
-	// Auto migrate database
+func migrate(db *gorm.DB) error {
 	logger.Log(logger.DEBUG, "Running database migrations...")
-	if err := db.AutoMigrate(
+	if err := database.MigrateRefreshTokenHashes(db, config.RefreshTokenHashKey()); err != nil {
+		return err
+	}
+	if err := database.MigrateVerifiedAt(db); err != nil {
+		return err
+	}
+	if err := database.MigrateMealTypes(db, config.GetEnv("MEAL_TYPE_MIGRATION_TIMEZONE", "UTC")); err != nil {
+		return err
+	}
+	return db.AutoMigrate(
 		&models.User{},
 		&models.Meal{},
+		&models.Tag{},
 		&models.UserStats{},
 		&models.RefreshToken{},
-	); err != nil {
+		&models.SecurityEvent{},
+		&models.PasswordResetToken{},
+		&models.EmailVerificationToken{},
+		&models.RecoveryCode{},
+		&models.LoginThrottle{},
+		&models.SigningKey{},
+		&models.PersonalAccessToken{},
+		&models.CoachClient{},
+		&models.MealComment{},
+		&models.OIDCLoginState{},
+		&models.UserIdentity{},
+		&models.MagicLinkToken{},
+		&models.MagicLinkRequest{},
+		&models.PasswordResetRequest{},
+	)
+}
+
+func runCommand(db *gorm.DB, command string) {
+	if err := migrate(db); err != nil {
+		logger.Log(logger.ERROR, "Failed to migrate database: "+err.Error())
+		os.Exit(1)
+	}
+	ctx := context.Background()
+	switch command {
+	case "recompute-stats":
+		// rebuild every user's stats from their meal history
+		count, err := repositories.NewUserStatsRepository(db).RecomputeAllStats(ctx)
+		if err != nil {
+			logger.Log(logger.ERROR, "Failed to recompute stats after "+strconv.Itoa(count)+" users: "+err.Error())
+			os.Exit(1)
+		}
+		logger.Log(logger.INFO, "Recomputed stats for "+strconv.Itoa(count)+" users")
+	case "set-role":
+		// go run main.go set-role <email> <user|coach|admin>, e.g. to create the first admin
+		setRole(ctx, db, os.Args[2:])
+	case "purge-deleted-users":
+		// hard delete accounts whose deletion grace period is over
+		purgeDeletedUsers(ctx, db)
+	default:
+		logger.Log(logger.ERROR, "Unknown command: "+command)
+	}
+}
+
+func setRole(ctx context.Context, db *gorm.DB, args []string) {
+	if len(args) != 2 || (args[1] != models.RoleUser && args[1] != models.RoleCoach && args[1] != models.RoleAdmin) {
+		logger.Log(logger.ERROR, "Usage: set-role <email> <user|coach|admin>")
+		return
+	}
+	usersRepo := repositories.NewUserRepository(db, repositories.UserRepositoryOptions{})
+	user, err := usersRepo.GetUserByEmail(ctx, args[0])
+	if err != nil {
+		logger.Log(logger.ERROR, "User not found: "+args[0])
+		return
+	}
+	if _, err := usersRepo.SetUserRole(ctx, user.ID, args[1], uuid.Nil); err != nil {
+		logger.Log(logger.ERROR, "Failed to set role: "+err.Error())
+		return
+	}
+	logger.Log(logger.INFO, "User "+user.Email+" is now "+args[1])
+}
+
+func purgeDeletedUsers(ctx context.Context, db *gorm.DB) {
+	purged, err := repositories.NewUserRepository(db, repositories.UserRepositoryOptions{}).PurgeDeletedUsers(ctx)
+	if err != nil {
+		logger.Log(logger.ERROR, "Failed to purge deleted users: "+err.Error())
+		return
+	}
+	if purged > 0 {
+		logger.Log(logger.INFO, "Purged "+strconv.FormatInt(purged, 10)+" deleted users")
+	}
+}
+
+func initServer(db *gorm.DB) {
+	// Auto migrate database
+	if err := migrate(db); err != nil {
 		logger.Log(logger.ERROR, "Failed to migrate database: "+err.Error())
 		return
 	}
@@ -72,7 +167,7 @@ func initServer(db *gorm.DB) {
 			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-			c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+			c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 			if c.Request.Method == "OPTIONS" {
 				c.AbortWithStatus(204)
@@ -86,6 +181,16 @@ func initServer(db *gorm.DB) {
 		logger.Log(logger.ERROR, "Error seeding database :: "+err.Error())
 	}
 
+	// purge accounts past their deletion grace period every hour
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			purgeDeletedUsers(ctx, db)
+			<-ticker.C
+		}
+	}()
+
 	// router middlewares
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
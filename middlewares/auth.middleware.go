@@ -1,13 +1,20 @@
 package middlewares
 
 import (
+	"daily-diet-backend/models"
 	"daily-diet-backend/services"
+	"daily-diet-backend/utils/errors"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware(authService services.AuthService) gin.HandlerFunc {
+// AuthMiddleware accepts a JWT, or a personal access token when the route
+// declares scopes and the token has all of them. Routes without scopes are
+// only reachable with a JWT. A JWT stops working as soon as its session is
+// revoked or the account disabled, and the role is read from the database.
+func AuthMiddleware(authService services.AuthService, scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.GetHeader("Authorization")
 		if tokenString == "" {
@@ -19,14 +26,77 @@ func AuthMiddleware(authService services.AuthService) gin.HandlerFunc {
 		if len(tokenString) > 7 && tokenString[:7] == "Bearer " {
 			tokenString = tokenString[7:]
 		}
+		if strings.HasPrefix(tokenString, models.PersonalAccessTokenPrefix) {
+			authenticatePersonalAccessToken(c, authService, tokenString, scopes)
+			return
+		}
+
 		claims, err := authService.ValidateToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
-		c.Set("email", claims.Email)
-		c.Set("userId", claims.ID.String())
+		user, err := authService.GetSessionUser(c, claims)
+		if err != nil {
+			status := errors.HTTPStatus(err)
+			message := "Invalid token"
+			if status == http.StatusForbidden {
+				message = "Account disabled"
+			} else if status != http.StatusInternalServerError {
+				status = http.StatusUnauthorized
+			}
+			c.JSON(status, gin.H{"error": message})
+			c.Abort()
+			return
+		}
+		c.Set("email", user.Email)
+		c.Set("userId", user.ID.String())
+		c.Set("verified", user.VerifiedAt != nil)
+		c.Set("role", user.Role)
+		if claims.SessionID != nil {
+			c.Set("sessionId", claims.SessionID.String())
+		}
 		c.Next()
 	}
 }
+
+func authenticatePersonalAccessToken(c *gin.Context, authService services.AuthService, tokenString string, scopes []string) {
+	if len(scopes) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Personal access tokens are not allowed here"})
+		c.Abort()
+		return
+	}
+	token, err := authService.ValidatePersonalAccessToken(c, tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return
+	}
+	for _, scope := range scopes {
+		if !token.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Token is missing scope " + scope})
+			c.Abort()
+			return
+		}
+	}
+	c.Set("email", token.User.Email)
+	c.Set("userId", token.UserID.String())
+	c.Set("verified", token.User.VerifiedAt != nil)
+	c.Set("role", token.User.Role)
+	c.Set("scopes", token.ScopeList())
+	c.Next()
+}
+
+// RequireVerifiedEmail blocks unverified users when the unverified user
+// policy does not allow them to write meals. Must run after AuthMiddleware.
+func RequireVerifiedEmail(authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authService.UnverifiedPolicy() == models.UnverifiedPolicyAllow || c.GetBool("verified") {
+			c.Next()
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email not verified"})
+		c.Abort()
+	}
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DeleteAccountDTO struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type DeleteAccountResponse struct {
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+}
+
+// UserExport gathers every record kept about a user
+type UserExport struct {
+	User     *User
+	Meals    []Meal
+	Stats    *UserStats
+	Sessions []RefreshToken
+}
+
+type SessionExportDTO struct {
+	ID        uuid.UUID  `json:"id"`
+	FamilyID  uuid.UUID  `json:"family_id"`
+	DeviceID  *string    `json:"device_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	ExpireAt  time.Time  `json:"expire_at"`
+	RotatedAt *time.Time `json:"rotated_at"`
+	Revoked   bool       `json:"revoked"`
+}
+
+type UserExportDTO struct {
+	ExportedAt time.Time          `json:"exported_at"`
+	Profile    UserProfileDTO     `json:"profile"`
+	Meals      []GetMealDTO       `json:"meals"`
+	Stats      UserStatsDTO       `json:"stats"`
+	Sessions   []SessionExportDTO `json:"sessions"`
+}
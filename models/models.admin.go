@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AdminListUsersQuery struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit"`
+	// Matched against name and email
+	Search   string `form:"q"`
+	Role     string `form:"role" binding:"omitempty,oneof=user coach admin"`
+	Disabled *bool  `form:"disabled"`
+}
+
+// UsersPage is a page of users as loaded from the database, newest first
+type UsersPage struct {
+	Users      []User
+	NextCursor *string
+}
+
+type AdminUserDTO struct {
+	ID                  uuid.UUID  `json:"id"`
+	Name                string     `json:"name"`
+	Email               string     `json:"email"`
+	Role                string     `json:"role"`
+	Verified            bool       `json:"verified"`
+	TwoFactorEnabled    bool       `json:"two_factor_enabled"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+type AdminUsersResponse struct {
+	Users      []AdminUserDTO `json:"users"`
+	NextCursor *string        `json:"next_cursor"`
+}
+
+type SetRoleDTO struct {
+	Role string `json:"role" binding:"required,oneof=user coach admin"`
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
@@ -9,12 +11,31 @@ type LoginDTO struct {
 	Email    string  `json:"email" binding:"required"`
 	Password string  `json:"password" binding:"required"`
 	DeviceID *string `json:"device_id,omitempty"`
+	// Set by the controller, failed logins are throttled per IP
+	ClientIP string `json:"-"`
 }
 
+// LoginResponse is the result of every way to start or refresh a session,
+// sent to clients as LoginResponseDTO
 type LoginResponse struct {
-	Token        string `json:"token"`
-	RefreshToken string `json:"refresh_token"`
-	User         User   `json:"user"`
+	Token        string
+	TokenType    string
+	ExpiresAt    time.Time
+	RefreshToken string
+	SessionID    uuid.UUID
+	User         User
+	// Set instead of the tokens when a second factor is needed
+	TwoFactorRequired bool
+	ChallengeToken    string
+}
+
+type LoginResponseDTO struct {
+	Token        string         `json:"token"`
+	TokenType    string         `json:"token_type"`
+	ExpiresAt    time.Time      `json:"expires_at"`
+	RefreshToken string         `json:"refresh_token"`
+	SessionID    uuid.UUID      `json:"session_id"`
+	User         UserProfileDTO `json:"user"`
 }
 
 type UserDTO struct {
@@ -23,19 +44,40 @@ type UserDTO struct {
 }
 
 type CreateUserDTO struct {
-	Email    string `json:"email"`
-	Name     string `json:"name"`
-	Password string `json:"password"`
+	Email    string `json:"email" binding:"required,email"`
+	Name     string `json:"name" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
 }
 
 type UpdateUserDTO struct {
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Name  *string `json:"name,omitempty" binding:"omitempty,min=1"`
+	Email *string `json:"email,omitempty" binding:"omitempty,email"`
+	// Required to change the email
+	CurrentPassword string `json:"current_password,omitempty" binding:"required_with=Email"`
+}
+
+type ChangePasswordDTO struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+type UserProfileDTO struct {
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	Verified bool      `json:"verified"`
+	// New email waiting for confirmation
+	PendingEmail *string   `json:"pending_email,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
 type JwtTokenClaims struct {
-	Email string    `json:"email"`
-	ID    uuid.UUID `json:"id"`
+	Email    string    `json:"email"`
+	ID       uuid.UUID `json:"id"`
+	Verified bool      `json:"verified"`
+	Role     string    `json:"role"`
+	// Refresh token family the access token was issued for
+	SessionID *uuid.UUID `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CoachingStatusPending  = "pending"
+	CoachingStatusActive   = "active"
+	CoachingStatusDeclined = "declined"
+	CoachingStatusRevoked  = "revoked"
+)
+
+// CoachClient grants a coach read access to the data of a client. The client
+// invites the coach, the coach accepts, either side can revoke it.
+type CoachClient struct {
+	ID       uuid.UUID `json:"id" gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	ClientID uuid.UUID `json:"client_id" gorm:"type:uuid;not null;index;uniqueIndex:idx_coach_clients_open,where:status = 'pending' OR status = 'active'"`
+	CoachID  uuid.UUID `json:"coach_id" gorm:"type:uuid;not null;index;uniqueIndex:idx_coach_clients_open,where:status = 'pending' OR status = 'active'"`
+	// One of the CoachingStatus* values
+	Status string `json:"status" gorm:"type:varchar(16);not null;index"`
+	// Space separated scopes, ScopeMealsRead, ScopeStatsRead and/or
+	// ScopeMealsVerdict
+	Scopes      string     `json:"scopes" gorm:"type:varchar(255);not null"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	RespondedAt *time.Time `json:"responded_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	Client      User       `json:"-" gorm:"foreignKey:ClientID;references:ID;constraint:OnDelete:CASCADE"`
+	Coach       User       `json:"-" gorm:"foreignKey:CoachID;references:ID;constraint:OnDelete:CASCADE"`
+}
+
+func (CoachClient) TableName() string {
+	return "coach_clients"
+}
+
+func (relation *CoachClient) ScopeList() []string {
+	return strings.Fields(relation.Scopes)
+}
+
+type CoachingInviteDTO struct {
+	CoachEmail string   `json:"coach_email" binding:"required,email"`
+	Scopes     []string `json:"scopes" binding:"required,min=1,dive,oneof=meals:read stats:read meals:verdict"`
+}
+
+type UserSummaryDTO struct {
+	ID    uuid.UUID `json:"id"`
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+}
+
+type CoachClientDTO struct {
+	ID          uuid.UUID      `json:"id"`
+	Coach       UserSummaryDTO `json:"coach"`
+	Client      UserSummaryDTO `json:"client"`
+	Status      string         `json:"status"`
+	Scopes      []string       `json:"scopes"`
+	CreatedAt   time.Time      `json:"created_at"`
+	RespondedAt *time.Time     `json:"responded_at"`
+	RevokedAt   *time.Time     `json:"revoked_at"`
+}
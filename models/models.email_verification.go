@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Policies applied to users that did not verify their email yet
+const (
+	UnverifiedPolicyAllow      = "allow"
+	UnverifiedPolicyBlockMeals = "block_meals"
+	UnverifiedPolicyBlockLogin = "block_login"
+)
+
+type EmailVerificationToken struct {
+	ID uuid.UUID `json:"id" gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	// Keyed hash of the token sent by email
+	TokenHash string    `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	// Address the token was sent to, verification fails if the user changed it since
+	Email string `json:"email" gorm:"not null"`
+	// Session that asked for an email change, the others are revoked once
+	// the new address is confirmed
+	SessionID *uuid.UUID `json:"-" gorm:"type:uuid"`
+	ExpireAt  time.Time  `json:"expire_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime;index"`
+	User      User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
+}
+
+func (EmailVerificationToken) TableName() string {
+	return "email_verification_tokens"
+}
+
+type VerifyEmailDTO struct {
+	Token string `json:"token" form:"token" binding:"required"`
+}
+
+type ResendVerificationDTO struct {
+	Email string `json:"email" binding:"required,email"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	LoginThrottleScopeAccount = "account"
+	LoginThrottleScopeIP      = "ip"
+	// Failed second factor codes, keyed by user id
+	LoginThrottleScopeTwoFactor = "2fa"
+)
+
+// LoginThrottle counts the failed logins of an account (by email), of a
+// client IP or the failed second factor codes of a user, repeated failures
+// lock it with an exponential backoff
+type LoginThrottle struct {
+	Scope         string     `json:"scope" gorm:"primarykey;type:varchar(16)"`
+	Key           string     `json:"key" gorm:"primarykey;type:varchar(255)"`
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt *time.Time `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+func (LoginThrottle) TableName() string {
+	return "login_throttles"
+}
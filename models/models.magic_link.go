@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MagicLinkToken signs a user in without a password. It is bound to the
+// device that asked for it, only that device can exchange it.
+type MagicLinkToken struct {
+	ID uuid.UUID `json:"id" gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	// Keyed hash of the token sent by email
+	TokenHash string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	DeviceID  string     `json:"device_id" gorm:"type:varchar(255);not null"`
+	ExpireAt  time.Time  `json:"expire_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	User      User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
+}
+
+func (MagicLinkToken) TableName() string {
+	return "magic_link_tokens"
+}
+
+// MagicLinkRequest records a magic link request, known email or not, for
+// the per email and per IP limits
+type MagicLinkRequest struct {
+	ID uuid.UUID `json:"id" gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	// Keyed hash of the lowercased email
+	EmailHash string    `json:"-" gorm:"type:varchar(64);not null;index"`
+	ClientIP  string    `json:"client_ip" gorm:"type:varchar(64);not null;index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+func (MagicLinkRequest) TableName() string {
+	return "magic_link_requests"
+}
+
+type MagicLinkRequestDTO struct {
+	Email    string `json:"email" binding:"required,email"`
+	DeviceID string `json:"device_id" binding:"required,max=255"`
+	// Set by the controller, requests are limited per IP
+	ClientIP string `json:"-"`
+}
+
+type MagicLinkExchangeDTO struct {
+	Token    string `json:"token" binding:"required"`
+	DeviceID string `json:"device_id" binding:"required,max=255"`
+}
@@ -16,18 +16,101 @@ type Meal struct {
 	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 	InDiet      bool      `json:"in_diet" gorm:"not null"`
+	// Latest in diet verdict of a coach, it wins over InDiet without
+	// changing what the owner entered. Cleared when the coach relationship
+	// ends, and ignored once the coach account is gone.
+	CoachVerdict   *bool      `json:"coach_verdict"`
+	CoachVerdictBy *uuid.UUID `json:"-" gorm:"type:uuid;index"`
+	VerdictCoach   *User      `json:"-" gorm:"foreignKey:CoachVerdictBy;references:ID;constraint:OnDelete:SET NULL"`
+	// One of the MealType* values
+	MealType string `json:"meal_type" gorm:"type:varchar(16);not null;default:'snack';index"`
+	Tags     []Tag  `json:"-" gorm:"many2many:meal_tags;constraint:OnDelete:CASCADE"`
+	// Optional nutrition facts, calories in kcal and the rest in grams
+	Calories *int     `json:"calories"`
+	Protein  *float64 `json:"protein" gorm:"type:numeric(7,2)"`
+	Carbs    *float64 `json:"carbs" gorm:"type:numeric(7,2)"`
+	Fat      *float64 `json:"fat" gorm:"type:numeric(7,2)"`
+	Fiber    *float64 `json:"fiber" gorm:"type:numeric(7,2)"`
 }
 
 func (Meal) TableName() string {
 	return "meals"
 }
 
+// EffectiveInDietSQL is the in diet value counted in filters and statistics,
+// the verdict of a coach still around wins over the flag set by the owner
+const EffectiveInDietSQL = "CASE WHEN coach_verdict_by IS NOT NULL AND coach_verdict IS NOT NULL THEN coach_verdict ELSE in_diet END"
+
+// ActiveCoachVerdict returns the coach verdict EffectiveInDietSQL counts, if any
+func (meal *Meal) ActiveCoachVerdict() *bool {
+	if meal.CoachVerdictBy == nil {
+		return nil
+	}
+	return meal.CoachVerdict
+}
+
+// EffectiveInDiet is the Go side of EffectiveInDietSQL
+func (meal *Meal) EffectiveInDiet() bool {
+	if verdict := meal.ActiveCoachVerdict(); verdict != nil {
+		return *verdict
+	}
+	return meal.InDiet
+}
+
+const (
+	MealTypeBreakfast = "breakfast"
+	MealTypeLunch     = "lunch"
+	MealTypeDinner    = "dinner"
+	MealTypeSnack     = "snack"
+)
+
+// MealTypes lists every meal type in the order of the day
+var MealTypes = []string{MealTypeBreakfast, MealTypeLunch, MealTypeDinner, MealTypeSnack}
+
+// MealTypeWindow is the range of hours, From included and To excluded, a
+// meal type is inferred for
+type MealTypeWindow struct {
+	MealType string
+	From     int
+	To       int
+}
+
+// MealTypeWindows are the local hours meal types are inferred from, meals outside
+// of them are snacks
+var MealTypeWindows = []MealTypeWindow{
+	{MealType: MealTypeBreakfast, From: 4, To: 11},
+	{MealType: MealTypeLunch, From: 11, To: 15},
+	{MealType: MealTypeDinner, From: 18, To: 22},
+}
+
+// InferMealType returns the meal type of a meal eaten at t, in the offset t
+// was sent with
+func InferMealType(t time.Time) string {
+	hour := t.Hour()
+	for _, window := range MealTypeWindows {
+		if hour >= window.From && hour < window.To {
+			return window.MealType
+		}
+	}
+	return MealTypeSnack
+}
+
 type EditMealDTO struct {
 	Name        *string    `json:"name,omitempty"`
 	Description *string    `json:"description,omitempty"`
 	Date        *time.Time `json:"date,omitempty"`
 	Time        *time.Time `json:"time,omitempty"`
 	InDiet      *bool      `json:"in_diet,omitempty"`
+	MealType    *string    `json:"meal_type,omitempty" binding:"omitempty,oneof=breakfast lunch dinner snack"`
+	// Replaces every tag of the meal, an empty list removes them
+	Tags     *[]string `json:"tags,omitempty" binding:"omitempty,max=20,dive,required,max=50"`
+	Calories *int      `json:"calories,omitempty" binding:"omitempty,gte=0,lte=20000"`
+	Protein  *float64  `json:"protein,omitempty" binding:"omitempty,gte=0,lte=2000"`
+	Carbs    *float64  `json:"carbs,omitempty" binding:"omitempty,gte=0,lte=2000"`
+	Fat      *float64  `json:"fat,omitempty" binding:"omitempty,gte=0,lte=2000"`
+	Fiber    *float64  `json:"fiber,omitempty" binding:"omitempty,gte=0,lte=2000"`
+	// Nutrition facts to remove, a cleared fact cannot be set in the same edit
+	ClearMacros []string `json:"clear_macros,omitempty" binding:"omitempty,dive,oneof=calories protein carbs fat fiber"`
 }
 
 type CreateMealDTO struct {
@@ -36,6 +119,16 @@ type CreateMealDTO struct {
 	Date        time.Time `json:"date" binding:"required"` // Format: YYYY-MM-DD
 	Time        time.Time `json:"time" binding:"required"` // Format: HH:mm
 	InDiet      bool      `json:"in_diet" binding:"boolean"`
+	// Inferred from Time when omitted
+	MealType *string `json:"meal_type,omitempty" binding:"omitempty,oneof=breakfast lunch dinner snack"`
+	// Tag names, created on first use
+	Tags []string `json:"tags,omitempty" binding:"omitempty,max=20,dive,required,max=50"`
+	// Optional nutrition facts, calories in kcal and the rest in grams
+	Calories *int     `json:"calories,omitempty" binding:"omitempty,gte=0,lte=20000"`
+	Protein  *float64 `json:"protein,omitempty" binding:"omitempty,gte=0,lte=2000"`
+	Carbs    *float64 `json:"carbs,omitempty" binding:"omitempty,gte=0,lte=2000"`
+	Fat      *float64 `json:"fat,omitempty" binding:"omitempty,gte=0,lte=2000"`
+	Fiber    *float64 `json:"fiber,omitempty" binding:"omitempty,gte=0,lte=2000"`
 }
 
 type GetMealDTO struct {
@@ -44,5 +137,129 @@ type GetMealDTO struct {
 	Description string    `json:"description"`
 	Date        time.Time `json:"date"`
 	Time        time.Time `json:"time"`
-	InDiet      bool      `json:"in_diet"`
+	// Owner flag unless a coach gave a verdict
+	InDiet bool `json:"in_diet"`
+	// What the owner entered and the coach verdict, if any
+	OwnerInDiet  bool      `json:"owner_in_diet"`
+	CoachVerdict *bool     `json:"coach_verdict"`
+	MealType     string    `json:"meal_type"`
+	Tags         []string  `json:"tags"`
+	Calories     *int      `json:"calories"`
+	Protein      *float64  `json:"protein"`
+	Carbs        *float64  `json:"carbs"`
+	Fat          *float64  `json:"fat"`
+	Fiber        *float64  `json:"fiber"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	// Comments by others the owner has not read yet, only set on lists
+	UnreadComments *int64 `json:"unread_comments,omitempty"`
+}
+
+const (
+	MealSortByDate      = "date"
+	MealSortByCreatedAt = "created_at"
+	SortOrderAsc        = "asc"
+	SortOrderDesc       = "desc"
+)
+
+type ListMealsQuery struct {
+	Cursor   string     `form:"cursor"`
+	Limit    int        `form:"limit"`
+	From     *time.Time `form:"from" time_format:"2006-01-02"` // Format: YYYY-MM-DD
+	To       *time.Time `form:"to" time_format:"2006-01-02"`   // Format: YYYY-MM-DD
+	InDiet   *bool      `form:"in_diet"`
+	Name     string     `form:"name"`
+	MealType string     `form:"meal_type" binding:"omitempty,oneof=breakfast lunch dinner snack"`
+	// Repeat to filter by several tags, e.g. tag=restaurant&tag=cheat day
+	Tags []string `form:"tag" binding:"omitempty,max=20,dive,max=50"`
+	// Whether meals need any (default) or all of the tags
+	TagMatch string `form:"tag_match" binding:"omitempty,oneof=any all"`
+	SortBy   string `form:"sort_by" binding:"omitempty,oneof=date created_at"`
+	Order    string `form:"order" binding:"omitempty,oneof=asc desc"`
+}
+
+// MealsPage is a page of meals as loaded from the database
+type MealsPage struct {
+	Meals      []Meal
+	NextCursor *string
+	// Unread comment count per meal id, meals without any are missing
+	UnreadComments map[uuid.UUID]int64
+}
+
+type ListMealsResponse struct {
+	Meals      []GetMealDTO `json:"meals"`
+	NextCursor *string      `json:"next_cursor"`
+}
+
+type TimelineQuery struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit"` // days per page
+}
+
+// MealDay groups the meals registered on a single day
+type MealDay struct {
+	Day              string // Format: YYYY-MM-DD
+	TotalMeals       int
+	InDietMeals      int
+	InDietPercentage float64
+	Meals            []Meal
+}
+
+// Timeline is a page of days as loaded from the database
+type Timeline struct {
+	Days       []MealDay
+	NextCursor *string
+}
+
+type MealDayDTO struct {
+	Day              string       `json:"day"` // Format: YYYY-MM-DD
+	TotalMeals       int          `json:"total_meals"`
+	InDietMeals      int          `json:"in_diet_meals"`
+	InDietPercentage float64      `json:"in_diet_percentage"`
+	Meals            []GetMealDTO `json:"meals"`
+}
+
+type TimelineResponse struct {
+	Days       []MealDayDTO `json:"days"`
+	NextCursor *string      `json:"next_cursor"`
+}
+
+const (
+	MacroPeriodDay  = "day"
+	MacroPeriodWeek = "week"
+)
+
+type MacroTotalsQuery struct {
+	From *time.Time `form:"from" time_format:"2006-01-02"` // Format: YYYY-MM-DD
+	To   *time.Time `form:"to" time_format:"2006-01-02"`   // Format: YYYY-MM-DD
+}
+
+// MacroTotals sums the nutrition facts of the meals of a day or a week,
+// meals without a value count as zero
+type MacroTotals struct {
+	PeriodStart string // Format: YYYY-MM-DD, weeks start on Monday
+	Meals       int
+	// Meals with at least one nutrition fact
+	TrackedMeals int
+	Calories     int64
+	Protein      float64
+	Carbs        float64
+	Fat          float64
+	Fiber        float64
+}
+
+type MacroTotalsDTO struct {
+	PeriodStart  string  `json:"period_start"` // Format: YYYY-MM-DD
+	Meals        int     `json:"meals"`
+	TrackedMeals int     `json:"tracked_meals"`
+	Calories     int64   `json:"calories"`
+	Protein      float64 `json:"protein"`
+	Carbs        float64 `json:"carbs"`
+	Fat          float64 `json:"fat"`
+	Fiber        float64 `json:"fiber"`
+}
+
+type MacroTotalsResponse struct {
+	Period string           `json:"period"` // day or week
+	Totals []MacroTotalsDTO `json:"totals"`
 }
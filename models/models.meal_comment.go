@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MealComment is feedback on a meal by its owner or a coach of the owner. The
+// latest verdict of a coach is kept as the CoachVerdict of the meal.
+type MealComment struct {
+	ID       uuid.UUID `json:"id" gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	MealID   uuid.UUID `json:"meal_id" gorm:"type:uuid;not null;index"`
+	AuthorID uuid.UUID `json:"author_id" gorm:"type:uuid;not null;index"`
+	Body     string    `json:"body" gorm:"type:text;not null"`
+	// In diet verdict of a coach, nil for plain comments
+	Verdict *bool `json:"verdict"`
+	// Set when the comment cleared the verdict of the meal
+	VerdictCleared bool `json:"verdict_cleared" gorm:"not null;default:false"`
+	// Set once the meal owner listed the comment, comments of the owner are
+	// read from the start
+	ReadAt    *time.Time `json:"read_at" gorm:"index"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	Meal      Meal       `json:"-" gorm:"foreignKey:MealID;references:ID;constraint:OnDelete:CASCADE"`
+	Author    User       `json:"-" gorm:"foreignKey:AuthorID;references:ID;constraint:OnDelete:CASCADE"`
+}
+
+func (MealComment) TableName() string {
+	return "meal_comments"
+}
+
+type CreateMealCommentDTO struct {
+	Body string `json:"body" binding:"required,max=2000"`
+	// Only coaches granted meals:verdict can give one, it wins over the
+	// in_diet flag of the owner. An explicit null clears the verdict of the
+	// meal, the owner can clear it too.
+	Verdict OptionalBool `json:"verdict" swaggertype:"boolean"`
+}
+
+type MealCommentDTO struct {
+	ID      uuid.UUID      `json:"id"`
+	MealID  uuid.UUID      `json:"meal_id"`
+	Author  UserSummaryDTO `json:"author"`
+	Body    string         `json:"body"`
+	Verdict *bool          `json:"verdict"`
+	// The comment cleared the verdict of the meal
+	VerdictCleared bool       `json:"verdict_cleared"`
+	ReadAt         *time.Time `json:"read_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// OptionalBool tells an absent field apart from an explicit null, Set is
+// true whenever the field was sent
+type OptionalBool struct {
+	Set   bool
+	Value *bool
+}
+
+func (optional *OptionalBool) UnmarshalJSON(data []byte) error {
+	optional.Set = true
+	if string(data) == "null" {
+		optional.Value = nil
+		return nil
+	}
+	return json.Unmarshal(data, &optional.Value)
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCreateMealCommentVerdict(t *testing.T) {
+	yes := true
+	cases := []struct {
+		name  string
+		body  string
+		set   bool
+		value *bool
+	}{
+		{"absent", `{"body":"ok"}`, false, nil},
+		{"explicit null", `{"body":"ok","verdict":null}`, true, nil},
+		{"given", `{"body":"ok","verdict":true}`, true, &yes},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var data CreateMealCommentDTO
+			if err := json.Unmarshal([]byte(tc.body), &data); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if data.Verdict.Set != tc.set {
+				t.Errorf("Set = %v, want %v", data.Verdict.Set, tc.set)
+			}
+			if (data.Verdict.Value == nil) != (tc.value == nil) ||
+				(tc.value != nil && *data.Verdict.Value != *tc.value) {
+				t.Errorf("Value = %v, want %v", data.Verdict.Value, tc.value)
+			}
+		})
+	}
+}
+
+func TestEffectiveInDiet(t *testing.T) {
+	no := false
+	coach := uuid.New()
+	cases := []struct {
+		name string
+		meal Meal
+		want bool
+	}{
+		{"owner flag", Meal{InDiet: true}, true},
+		{"coach verdict wins", Meal{InDiet: true, CoachVerdict: &no, CoachVerdictBy: &coach}, false},
+		{"verdict of a deleted coach is ignored", Meal{InDiet: true, CoachVerdict: &no}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.meal.EffectiveInDiet(); got != tc.want {
+				t.Errorf("EffectiveInDiet() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
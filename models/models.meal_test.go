@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInferMealType(t *testing.T) {
+	tests := []struct {
+		name string
+		time string
+		want string
+	}{
+		{"breakfast behind UTC", "2026-10-17T08:30:00-03:00", MealTypeBreakfast},
+		{"breakfast ahead of UTC", "2026-10-17T08:30:00+09:00", MealTypeBreakfast},
+		{"lunch", "2026-10-17T12:00:00Z", MealTypeLunch},
+		{"afternoon snack", "2026-10-17T16:00:00+02:00", MealTypeSnack},
+		{"dinner", "2026-10-17T19:45:00-07:00", MealTypeDinner},
+		{"window start is included", "2026-10-17T04:00:00+01:00", MealTypeBreakfast},
+		{"window end is excluded", "2026-10-17T22:00:00+01:00", MealTypeSnack},
+		{"night snack", "2026-10-17T02:00:00Z", MealTypeSnack},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			eatenAt, err := time.Parse(time.RFC3339, test.time)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := InferMealType(eatenAt); got != test.want {
+				t.Errorf("InferMealType(%s) = %s, want %s", test.time, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OIDCLoginState is a pending authorization request, consumed by the
+// callback. Only the hash of the state sent to the provider is stored.
+type OIDCLoginState struct {
+	ID           uuid.UUID `json:"id" gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	StateHash    string    `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	Nonce        string    `json:"-" gorm:"not null"`
+	CodeVerifier string    `json:"-" gorm:"not null"`
+	DeviceID     *string   `json:"device_id" gorm:"type:varchar(255)"`
+	ExpireAt     time.Time `json:"expire_at" gorm:"not null;index"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (OIDCLoginState) TableName() string {
+	return "oidc_login_states"
+}
+
+// UserIdentity links a user to an account at an identity provider
+type UserIdentity struct {
+	ID     uuid.UUID `json:"id" gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	UserID uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	// Issuer and subject of the ID token identify the provider account
+	Issuer      string     `json:"issuer" gorm:"not null;uniqueIndex:idx_user_identities_issuer_subject"`
+	Subject     string     `json:"subject" gorm:"not null;uniqueIndex:idx_user_identities_issuer_subject"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	User        User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// OIDCIdentityDTO is what the repository needs from a verified ID token
+type OIDCIdentityDTO struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type OIDCAuthorizeDTO struct {
+	DeviceID *string `json:"device_id,omitempty" form:"device_id"`
+}
+
+type OIDCAuthorizeResponse struct {
+	AuthorizationURL string    `json:"authorization_url"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+type OIDCCallbackDTO struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PasswordResetToken struct {
+	ID uuid.UUID `json:"id" gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	// Keyed hash of the token sent by email
+	TokenHash string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	ExpireAt  time.Time  `json:"expire_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	User      User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
+}
+
+func (PasswordResetToken) TableName() string {
+	return "password_reset_tokens"
+}
+
+// PasswordResetRequest records a forgot password request, known email or
+// not, for the per email and per IP limits
+type PasswordResetRequest struct {
+	ID uuid.UUID `json:"id" gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	// Keyed hash of the lowercased email
+	EmailHash string    `json:"-" gorm:"type:varchar(64);not null;index"`
+	ClientIP  string    `json:"client_ip" gorm:"type:varchar(64);not null;index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+func (PasswordResetRequest) TableName() string {
+	return "password_reset_requests"
+}
+
+type ForgotPasswordDTO struct {
+	Email string `json:"email" binding:"required,email"`
+	// Set by the controller, requests are limited per IP
+	ClientIP string `json:"-"`
+}
+
+type ResetPasswordDTO struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ScopeMealsRead  = "meals:read"
+	ScopeMealsWrite = "meals:write"
+	ScopeStatsRead  = "stats:read"
+	// Coaching only, lets a coach give in diet verdicts on meals
+	ScopeMealsVerdict = "meals:verdict"
+
+	// Every personal access token starts with it, so it cannot be mistaken
+	// for a JWT
+	PersonalAccessTokenPrefix = "ddp_"
+)
+
+// PersonalAccessToken is a long lived, scoped token created by a user for
+// scripts and integrations
+type PersonalAccessToken struct {
+	ID     uuid.UUID `json:"id" gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	UserID uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	Name   string    `json:"name" gorm:"type:varchar(100);not null"`
+	// Keyed hash of the token, the plain value is never stored
+	TokenHash string `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	// Plain token, only set in memory right after it is created
+	Token string `json:"-" gorm:"-"`
+	// First characters of the token, shown to recognize it
+	TokenPrefix string `json:"token_prefix" gorm:"type:varchar(16);not null"`
+	// Space separated scopes
+	Scopes     string     `json:"scopes" gorm:"type:varchar(255);not null"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	User       User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
+}
+
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
+
+func (token *PersonalAccessToken) ScopeList() []string {
+	return strings.Fields(token.Scopes)
+}
+
+func (token *PersonalAccessToken) HasScope(scope string) bool {
+	for _, granted := range token.ScopeList() {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type CreatePersonalAccessTokenDTO struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,oneof=meals:read meals:write stats:read"`
+	// Lifetime of the token, defaults to 30 days
+	ExpiresInDays int `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
+
+type PersonalAccessTokenDTO struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"token_prefix"`
+	Scopes      []string   `json:"scopes"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type CreatedPersonalAccessTokenDTO struct {
+	PersonalAccessTokenDTO
+	// Shown only once
+	Token string `json:"token"`
+}
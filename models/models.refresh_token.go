@@ -7,14 +7,23 @@ import (
 )
 
 type RefreshToken struct {
-	Token     string    `gorm:"type:varchar(255);primaryKey;not null" json:"token"`
-	UserID    uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
-	DeviceID  *string   `gorm:"type:varchar(255);" json:"device_id"`
+	ID uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	// Keyed hash of the token, the plain value is never stored
+	TokenHash string `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	// Plain token, only set in memory right after it is created
+	Token     string    `gorm:"-" json:"-"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index;index:idx_refresh_tokens_user_device" json:"user_id"`
+	DeviceID  *string   `gorm:"type:varchar(255);index:idx_refresh_tokens_user_device" json:"device_id"`
 	ExpireAt  time.Time `gorm:"type:timestamp;not null" json:"expire_at"`
 	CreatedAt time.Time `gorm:"type:timestamp;not null;" json:"created_at"`
 	UpdatedAt time.Time `gorm:"type:timestamp;not null;" json:"updated_at"`
 	Revoked   bool      `gorm:"type:boolean;not null;default:false;index" json:"revoked"`
-	User      User      `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE" json:"-"`
+	// Every token created by rotating a login token shares its FamilyID,
+	// ParentID points at the token it replaced
+	FamilyID  uuid.UUID  `gorm:"type:uuid;not null;index;default:uuid_generate_v4()" json:"family_id"`
+	ParentID  *uuid.UUID `gorm:"type:uuid" json:"parent_id"`
+	RotatedAt *time.Time `gorm:"type:timestamp" json:"rotated_at"`
+	User      User       `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE" json:"-"`
 }
 
 type CreateRefreshTokenDTO struct {
@@ -26,10 +35,13 @@ type ValidateRefreshTokenDTO struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-type ValidateRefreshTokenResponse struct {
-	RefreshToken *string    `json:"refresh_token"`
-	UserEmail    *string    `json:"user_email"`
-	UserID       *uuid.UUID `json:"user_id"`
+// SessionDTO describes a token family without exposing the token value
+type SessionDTO struct {
+	ID        uuid.UUID `json:"id"` // token family id
+	DeviceID  *string   `json:"device_id"`
+	CreatedAt time.Time `json:"created_at"`
+	LastUsed  time.Time `json:"last_used"`
+	ExpireAt  time.Time `json:"expire_at"`
 }
 
 // TableName specifies the table name for GORM
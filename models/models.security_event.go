@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SecurityEventRefreshTokenReuse = "REFRESH_TOKEN_REUSE"
+	SecurityEventLoginLockout      = "LOGIN_LOCKOUT"
+	SecurityEventAccountDisabled   = "ACCOUNT_DISABLED"
+	SecurityEventAccountEnabled    = "ACCOUNT_ENABLED"
+	SecurityEventForcedLogout      = "FORCED_LOGOUT"
+	SecurityEventRoleChanged       = "ROLE_CHANGED"
+	SecurityEventIdentityLinked    = "IDENTITY_LINKED"
+	SecurityEventEmailChanged      = "EMAIL_CHANGED"
+)
+
+type SecurityEvent struct {
+	ID        uuid.UUID  `json:"id" gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	UserID    *uuid.UUID `json:"user_id" gorm:"type:uuid;index"`
+	Type      string     `json:"type" gorm:"type:varchar(64);not null;index"`
+	DeviceID  *string    `json:"device_id" gorm:"type:varchar(255)"`
+	Details   string     `json:"details"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	User      *User      `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+func (SecurityEvent) TableName() string {
+	return "security_events"
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+const (
+	SigningAlgorithmRS256 = "RS256"
+	SigningAlgorithmEdDSA = "EdDSA"
+)
+
+// SigningKey is an asymmetric key access tokens are signed with. The newest
+// key signs, older keys keep verifying until ExpiresAt so tokens issued
+// before a rotation stay valid.
+type SigningKey struct {
+	// Sent as the kid header of the tokens
+	ID        string `json:"id" gorm:"primarykey;type:varchar(64)"`
+	Algorithm string `json:"algorithm" gorm:"type:varchar(16);not null"`
+	// Encrypted base64 PKCS #8 DER
+	PrivateKey string `json:"-" gorm:"type:text;not null"`
+	// Base64 PKIX DER
+	PublicKey string    `json:"public_key" gorm:"type:text;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+}
+
+func (SigningKey) TableName() string {
+	return "signing_keys"
+}
+
+// JWK is the public part of a SigningKey as a JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP curve and public key
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Tag is a label a user puts on their meals, names are unique per user
+type Tag struct {
+	ID        uuid.UUID `json:"id" gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_tags_user_name"`
+	Name      string    `json:"name" gorm:"type:varchar(50);not null;uniqueIndex:idx_tags_user_name"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	User      User      `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
+}
+
+func (Tag) TableName() string {
+	return "tags"
+}
+
+const (
+	TagMatchAny = "any"
+	TagMatchAll = "all"
+)
+
+// NormalizeTagName trims, lowercases and collapses the spaces of a tag name
+// so "Cheat  Day" and "cheat day" are the same tag
+func NormalizeTagName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+type ListTagsQuery struct {
+	// Prefix of the tag names
+	Q     string `form:"q"`
+	Limit int    `form:"limit"`
+}
+
+// TagUsage is a tag with the number of meals it is on
+type TagUsage struct {
+	Name      string
+	MealCount int64
+}
+
+type TagDTO struct {
+	Name      string `json:"name"`
+	MealCount int64  `json:"meal_count"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "testing"
+
+func TestNormalizeTagName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"cheat day", "cheat day"},
+		{"Cheat  Day", "cheat day"},
+		{"  vegan\t", "vegan"},
+		{"High\nProtein", "high protein"},
+		{"ÉTÉ", "été"},
+		{"   ", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := NormalizeTagName(test.name); got != test.want {
+			t.Errorf("NormalizeTagName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
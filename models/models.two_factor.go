@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// RecoveryCode is a single use code accepted instead of a TOTP code
+type RecoveryCode struct {
+	ID        uuid.UUID  `json:"id" gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	CodeHash  string     `json:"-" gorm:"type:varchar(64);not null;index"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	User      User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
+
+type TwoFactorSetupResponse struct {
+	Secret string `json:"secret"`
+	// otpauth:// URI, also the payload to render as QR code
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TwoFactorCodeDTO struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorEnableResponse struct {
+	// Shown only once, each code can replace a TOTP code one time
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorDisableDTO struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type TwoFactorLoginDTO struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	// TOTP code or recovery code
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorChallengeClaims is the short lived token returned by the password
+// step of a login when the user has two factor authentication enabled
+type TwoFactorChallengeClaims struct {
+	UserID   uuid.UUID `json:"uid"`
+	DeviceID *string   `json:"device_id,omitempty"`
+	jwt.RegisteredClaims
+}
@@ -6,6 +6,12 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	RoleUser  = "user"
+	RoleCoach = "coach"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	// Primary key field using UUID
 	ID uuid.UUID `json:"id" gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
@@ -13,20 +19,39 @@ type User struct {
 	Email string `json:"email" gorm:"unique;not null"`
 	// Required name field
 	Name string `json:"name" gorm:"not null"`
-	// Required password field
-	Password string `json:"password" gorm:"not null"`
+	// Required password field, bcrypt hash, never serialized
+	Password string `json:"-" gorm:"not null"`
+	// One of the Role* values, carried in the access token claims
+	Role string `json:"role" gorm:"type:varchar(16);not null;default:user;index"`
+	// Set by an admin, disabled users cannot log in or refresh sessions
+	DisabledAt *time.Time `json:"-"`
+	// Set once the user confirmed the email address, nil while unverified
+	VerifiedAt *time.Time `json:"verifiedAt"`
+	// New email asked for by the user, it replaces Email once confirmed
+	// through the link sent to it
+	PendingEmail *string `json:"-"`
+	// Encrypted TOTP secret, set during enrolment and kept while enabled
+	TOTPSecret *string `json:"-" gorm:"column:totp_secret"`
+	// Set once enrolment was confirmed with a valid code
+	TOTPEnabledAt *time.Time `json:"-" gorm:"column:totp_enabled_at"`
+	// Last accepted TOTP time step, a code cannot be used twice
+	TOTPLastStep int64 `json:"-" gorm:"column:totp_last_step;not null;default:0"`
+	// Set when the user asked to delete the account, the account is
+	// hard deleted after this time unless the user logs in again
+	DeletionScheduledAt *time.Time `json:"-" gorm:"index"`
 	// Automatically managed timestamp fields
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 	// One-to-Many relation with Meal
 	// - foreignKey:UserID: specifies the foreign key field in Meal table
 	// - constraint:OnDelete:CASCADE: deletes related meals when user is deleted
-	Meals []Meal `json:"meals" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Meals []Meal `json:"-" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
 
 	// Change the type from uuid.UUID to UserStats
-	UserStats UserStats `json:"user_stats" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
+	UserStats UserStats `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
 
-	RefreshToken *RefreshToken `json:"refresh_token,omitempty" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
+	// One-to-Many relation with RefreshToken, one active token per device
+	RefreshTokens []RefreshToken `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
 }
 
 func (User) TableName() string {
@@ -12,73 +12,52 @@ type UserStats struct {
 	User            *User     `json:"-" gorm:"foreignKey:UserID"`
 }
 
-func (UserStats) TableName() string {
-	return "user_stats"
+type UserStatsDTO struct {
+	RegisteredMeals int `json:"registeredMeals"`
+	InDietMeals     int `json:"inDietMeals"`
+	CurrentStreak   int `json:"currentStreak"`
+	MaxStreak       int `json:"maxStreak"`
 }
 
-func (userStats *UserStats) UpdateMaxStreak(
-	inDiet bool,
-	currentMax int,
-	current int,
-) int {
-	if inDiet {
-		if (current + 1) > currentMax {
-			return current + 1
-		}
-		if currentMax == 0 {
-			return 1
-		}
-	}
-	if currentMax == 0 {
-		return 0
-	}
-	return userStats.MaxStreak
+// MealTypeStats is the in diet share of the meals of one type
+type MealTypeStats struct {
+	MealType         string
+	TotalMeals       int
+	InDietMeals      int
+	InDietPercentage float64
 }
 
-func (userStats *UserStats) UpdateCurrentStreak(
-	inDiet bool,
-	current int,
-) int {
-	if inDiet {
-		return current + 1
-	}
-	return 0
+type MealTypeStatsDTO struct {
+	MealType         string  `json:"mealType"`
+	TotalMeals       int     `json:"totalMeals"`
+	InDietMeals      int     `json:"inDietMeals"`
+	InDietPercentage float64 `json:"inDietPercentage"`
 }
 
-func (userStats *UserStats) UpdateInDietMeals(
-	inDiet bool,
-	isNewMeal bool,
-	isDelete bool,
-	wasInDiet bool,
-	current int,
-) int {
-	if isNewMeal {
-		if inDiet {
-			return current + 1
-		}
-		return current
-	}
-
-	if isDelete {
-		if wasInDiet {
-			return current - 1
-		}
-		return current
-	}
+type MealTypeStatsResponse struct {
+	MealTypes []MealTypeStatsDTO `json:"mealTypes"`
+}
 
-	// Handling updates
-	if inDiet && !wasInDiet {
-		return current + 1
-	}
-	if !inDiet && wasInDiet {
-		return current - 1
-	}
-	return current
+func (UserStats) TableName() string {
+	return "user_stats"
 }
 
-func (userStats *UserStats) UpdateRegisteredMeals(isNew bool, current int) int {
-	if isNew {
-		return current + 1
+// ApplyHistory recomputes every counter from the in diet flag of all the
+// meals of the user, given in chronological (Date + Time) order
+func (userStats *UserStats) ApplyHistory(history []bool) {
+	userStats.RegisteredMeals = len(history)
+	userStats.InDietMeals = 0
+	userStats.CurrentStreak = 0
+	userStats.MaxStreak = 0
+	for _, inDiet := range history {
+		if !inDiet {
+			userStats.CurrentStreak = 0
+			continue
+		}
+		userStats.InDietMeals++
+		userStats.CurrentStreak++
+		if userStats.CurrentStreak > userStats.MaxStreak {
+			userStats.MaxStreak = userStats.CurrentStreak
+		}
 	}
-	return current - 1
 }
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestApplyHistory(t *testing.T) {
+	yes, no := true, false
+	coach := uuid.New()
+	on := Meal{InDiet: true}
+	off := Meal{InDiet: false}
+
+	// meals are given in the order RecomputeUserStats loads them
+	tests := []struct {
+		name                             string
+		meals                            []Meal
+		registered, inDiet, current, max int
+	}{
+		{"no meals", nil, 0, 0, 0, 0},
+		{"all in diet", []Meal{on, on, on}, 3, 3, 3, 3},
+		{"last meal off diet", []Meal{on, on, off}, 3, 2, 0, 2},
+		// a meal logged today for last week sorts before the recent ones
+		{"backdated off diet meal splits the streak", []Meal{on, off, on, on}, 4, 3, 2, 2},
+		{"backdated in diet meal extends the streak", []Meal{on, on, on, off, on}, 5, 4, 1, 3},
+		// breakfast off diet, dinner in diet on the same day, whatever the
+		// order they were logged in
+		{"same day by time of day", []Meal{off, on}, 2, 1, 1, 1},
+		{"same day and time by creation", []Meal{on, off}, 2, 1, 0, 1},
+		{"before deleting the off diet meal", []Meal{on, on, off, on}, 4, 3, 1, 2},
+		{"after deleting the off diet meal", []Meal{on, on, on}, 3, 3, 3, 3},
+		{
+			"coach verdict overrides in diet",
+			[]Meal{on, {InDiet: true, CoachVerdict: &no, CoachVerdictBy: &coach}, on},
+			3, 2, 1, 1,
+		},
+		{
+			"coach verdict counts an off diet meal",
+			[]Meal{on, {InDiet: false, CoachVerdict: &yes, CoachVerdictBy: &coach}, on},
+			3, 3, 3, 3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			history := make([]bool, len(test.meals))
+			for i := range test.meals {
+				history[i] = test.meals[i].EffectiveInDiet()
+			}
+			// stale counters must not leak into the result
+			stats := UserStats{RegisteredMeals: 9, InDietMeals: 9, CurrentStreak: 9, MaxStreak: 9}
+			stats.ApplyHistory(history)
+			if stats.RegisteredMeals != test.registered || stats.InDietMeals != test.inDiet ||
+				stats.CurrentStreak != test.current || stats.MaxStreak != test.max {
+				t.Errorf("got %d/%d streak %d max %d, want %d/%d streak %d max %d",
+					stats.RegisteredMeals, stats.InDietMeals, stats.CurrentStreak, stats.MaxStreak,
+					test.registered, test.inDiet, test.current, test.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/errors"
+	"daily-diet-backend/utils/pagination"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ListUsers returns a page of users, newest first, matching the search
+func (repo *userRepository) ListUsers(c context.Context, query models.AdminListUsersQuery) (*models.UsersPage, error) {
+	limit := pagination.NormalizeLimit(query.Limit)
+
+	db := repo.db.WithContext(c)
+	if query.Search != "" {
+		pattern := "%" + escapeLike(query.Search) + "%"
+		db = db.Where("name ILIKE ? OR email ILIKE ?", pattern, pattern)
+	}
+	if query.Role != "" {
+		db = db.Where("role = ?", query.Role)
+	}
+	if query.Disabled != nil {
+		if *query.Disabled {
+			db = db.Where("disabled_at IS NOT NULL")
+		} else {
+			db = db.Where("disabled_at IS NULL")
+		}
+	}
+	if query.Cursor != "" {
+		cursor, err := pagination.Decode(query.Cursor)
+		if err != nil || cursor.CreatedAt == nil {
+			return nil, errors.NewError(errors.Invalid, "invalid cursor", err)
+		}
+		db = db.Where("(created_at, id) < (?, ?)", *cursor.CreatedAt, cursor.ID)
+	}
+
+	// fetch one extra row to know if there is a next page
+	var users []models.User
+	if err := db.Order("created_at DESC").Order("id DESC").Limit(limit + 1).Find(&users).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error listing users", err)
+	}
+
+	page := &models.UsersPage{Users: users}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		last := page.Users[limit-1]
+		encoded, err := pagination.Encode(pagination.Cursor{ID: last.ID, CreatedAt: &last.CreatedAt})
+		if err != nil {
+			return nil, errors.NewError(errors.Internal, "error encoding cursor", err)
+		}
+		page.NextCursor = &encoded
+	}
+	return page, nil
+}
+
+func (repo *userRepository) SetUserRole(c context.Context, userId uuid.UUID, role string, actorId uuid.UUID) (*models.User, error) {
+	return repo.adminUpdateUser(c, userId, actorId, func(tx *gorm.DB, user *models.User) (*models.SecurityEvent, error) {
+		if user.Role == role {
+			return nil, nil
+		}
+		event := &models.SecurityEvent{
+			Type:    models.SecurityEventRoleChanged,
+			Details: "role changed from " + user.Role + " to " + role,
+		}
+		if err := tx.Model(user).Update("role", role).Error; err != nil {
+			return nil, errors.NewError(errors.Internal, "error updating role", err)
+		}
+		return event, nil
+	})
+}
+
+// SetUserDisabled disables or re-enables an account, disabling also signs out
+// every session
+func (repo *userRepository) SetUserDisabled(c context.Context, userId uuid.UUID, disabled bool, actorId uuid.UUID) (*models.User, error) {
+	return repo.adminUpdateUser(c, userId, actorId, func(tx *gorm.DB, user *models.User) (*models.SecurityEvent, error) {
+		if (user.DisabledAt != nil) == disabled {
+			return nil, nil
+		}
+		if !disabled {
+			if err := tx.Model(user).Update("disabled_at", nil).Error; err != nil {
+				return nil, errors.NewError(errors.Internal, "error enabling account", err)
+			}
+			return &models.SecurityEvent{Type: models.SecurityEventAccountEnabled}, nil
+		}
+
+		if err := tx.Model(user).Update("disabled_at", time.Now()).Error; err != nil {
+			return nil, errors.NewError(errors.Internal, "error disabling account", err)
+		}
+		if err := revokeUserRefreshTokens(tx, c, user.ID); err != nil {
+			return nil, err
+		}
+		return &models.SecurityEvent{Type: models.SecurityEventAccountDisabled}, nil
+	})
+}
+
+// ForceLogout revokes every session of a user
+func (repo *userRepository) ForceLogout(c context.Context, userId uuid.UUID, actorId uuid.UUID) error {
+	_, err := repo.adminUpdateUser(c, userId, actorId, func(tx *gorm.DB, user *models.User) (*models.SecurityEvent, error) {
+		if err := revokeUserRefreshTokens(tx, c, user.ID); err != nil {
+			return nil, err
+		}
+		return &models.SecurityEvent{Type: models.SecurityEventForcedLogout}, nil
+	})
+	return err
+}
+
+// adminUpdateUser runs update on the locked user and records the security
+// event it returns, attributed to the admin (uuid.Nil for the CLI)
+func (repo *userRepository) adminUpdateUser(
+	c context.Context,
+	userId uuid.UUID,
+	actorId uuid.UUID,
+	update func(tx *gorm.DB, user *models.User) (*models.SecurityEvent, error),
+) (*models.User, error) {
+	var user *models.User
+	txErr := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = lockUser(tx, c, userId)
+		if err != nil {
+			return err
+		}
+		event, err := update(tx, user)
+		if err != nil {
+			return err
+		}
+		if event != nil {
+			event.UserID = &user.ID
+			if event.Details != "" {
+				event.Details += ", "
+			}
+			if actorId == uuid.Nil {
+				event.Details += "from the command line"
+			} else {
+				event.Details += "by admin " + actorId.String()
+			}
+			if err := recordSecurityEvent(tx, c, event); err != nil {
+				return err
+			}
+		}
+		return tx.Where("id = ?", userId).First(user).Error
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+	return user, nil
+}
@@ -0,0 +1,201 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CoachingRepository interface {
+	Invite(c context.Context, clientId uuid.UUID, coachEmail string, scopes string) (*models.CoachClient, error)
+	ListRelationships(c context.Context, userId uuid.UUID) ([]models.CoachClient, error)
+	Respond(c context.Context, relationId uuid.UUID, coachId uuid.UUID, accept bool) (*models.CoachClient, error)
+	Revoke(c context.Context, relationId uuid.UUID, userId uuid.UUID) (*models.CoachClient, error)
+}
+
+type coachingRepository struct {
+	database *gorm.DB
+}
+
+func NewCoachingRepository(client *gorm.DB) CoachingRepository {
+	return &coachingRepository{database: client}
+}
+
+// checkReadAccess extends the user_id ownership check: the viewer may read
+// the data of ownerId when it is their own, or when they coach ownerId with
+// an active relationship granting scope
+func checkReadAccess(db *gorm.DB, c context.Context, viewerId uuid.UUID, ownerId uuid.UUID, scope string) error {
+	if viewerId == ownerId {
+		return nil
+	}
+	var count int64
+	if err := db.WithContext(c).
+		Model(&models.CoachClient{}).
+		Where("coach_id = ? AND client_id = ? AND status = ?", viewerId, ownerId, models.CoachingStatusActive).
+		Where("? = ANY(string_to_array(scopes, ' '))", scope).
+		Count(&count).Error; err != nil {
+		return errors.NewError(errors.Internal, "error checking access", err)
+	}
+	if count == 0 {
+		return errors.NewError(errors.Forbidden, "you are not allowed to see this user's data", nil)
+	}
+	return nil
+}
+
+func (repo *coachingRepository) Invite(
+	c context.Context,
+	clientId uuid.UUID,
+	coachEmail string,
+	scopes string,
+) (*models.CoachClient, error) {
+	var relation models.CoachClient
+	txErr := repo.database.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var coach models.User
+		if err := tx.Where("email = ? AND role = ?", coachEmail, models.RoleCoach).First(&coach).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.NewError(errors.NotFound, "coach not found", err)
+			}
+			return errors.NewError(errors.Internal, "error finding coach", err)
+		}
+		if coach.ID == clientId {
+			return errors.NewError(errors.Invalid, "you cannot coach yourself", nil)
+		}
+
+		var open int64
+		if err := tx.Model(&models.CoachClient{}).
+			Where("client_id = ? AND coach_id = ? AND status IN ?", clientId, coach.ID,
+				[]string{models.CoachingStatusPending, models.CoachingStatusActive}).
+			Count(&open).Error; err != nil {
+			return errors.NewError(errors.Internal, "error checking invitations", err)
+		}
+		if open > 0 {
+			return errors.NewError(errors.Invalid, "this coach is already invited", nil)
+		}
+
+		relation = models.CoachClient{
+			ClientID: clientId,
+			CoachID:  coach.ID,
+			Status:   models.CoachingStatusPending,
+			Scopes:   scopes,
+		}
+		if err := tx.Create(&relation).Error; err != nil {
+			return errors.NewError(errors.Internal, "error creating invitation", err)
+		}
+		return tx.Preload("Coach").Preload("Client").Where("id = ?", relation.ID).First(&relation).Error
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+	return &relation, nil
+}
+
+// ListRelationships returns the relationships of a user as client or coach,
+// newest first
+func (repo *coachingRepository) ListRelationships(c context.Context, userId uuid.UUID) ([]models.CoachClient, error) {
+	var relations []models.CoachClient
+	if err := repo.database.WithContext(c).
+		Preload("Coach").
+		Preload("Client").
+		Where("client_id = ? OR coach_id = ?", userId, userId).
+		Order("created_at DESC").
+		Find(&relations).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error listing relationships", err)
+	}
+	return relations, nil
+}
+
+// Respond accepts or declines a pending invitation, only the invited coach can
+func (repo *coachingRepository) Respond(
+	c context.Context,
+	relationId uuid.UUID,
+	coachId uuid.UUID,
+	accept bool,
+) (*models.CoachClient, error) {
+	return repo.update(c, relationId, func(tx *gorm.DB, relation *models.CoachClient) error {
+		if relation.CoachID != coachId {
+			return errors.NewError(errors.NotFound, "invitation not found", nil)
+		}
+		if relation.Status != models.CoachingStatusPending {
+			return errors.NewError(errors.Invalid, "invitation is not pending", nil)
+		}
+		status := models.CoachingStatusDeclined
+		if accept {
+			status = models.CoachingStatusActive
+		}
+		return tx.Model(relation).Updates(map[string]interface{}{
+			"status":       status,
+			"responded_at": time.Now(),
+		}).Error
+	})
+}
+
+// Revoke ends a pending or active relationship, either side can. Verdicts
+// the coach gave on meals of the client are cleared.
+func (repo *coachingRepository) Revoke(c context.Context, relationId uuid.UUID, userId uuid.UUID) (*models.CoachClient, error) {
+	return repo.update(c, relationId, func(tx *gorm.DB, relation *models.CoachClient) error {
+		if relation.CoachID != userId && relation.ClientID != userId {
+			return errors.NewError(errors.NotFound, "relationship not found", nil)
+		}
+		if relation.Status != models.CoachingStatusPending && relation.Status != models.CoachingStatusActive {
+			return errors.NewError(errors.Invalid, "relationship already ended", nil)
+		}
+		wasActive := relation.Status == models.CoachingStatusActive
+		if err := tx.Model(relation).Updates(map[string]interface{}{
+			"status":     models.CoachingStatusRevoked,
+			"revoked_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		if !wasActive {
+			return nil
+		}
+		// verdicts of a former coach no longer count for the client
+		cleared := tx.Model(&models.Meal{}).
+			Where("user_id = ? AND coach_verdict_by = ?", relation.ClientID, relation.CoachID).
+			Updates(map[string]interface{}{"coach_verdict": nil, "coach_verdict_by": nil})
+		if cleared.Error != nil {
+			return cleared.Error
+		}
+		if cleared.RowsAffected > 0 {
+			if _, err := RecomputeUserStats(tx, c, relation.ClientID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (repo *coachingRepository) update(
+	c context.Context,
+	relationId uuid.UUID,
+	update func(tx *gorm.DB, relation *models.CoachClient) error,
+) (*models.CoachClient, error) {
+	var relation models.CoachClient
+	txErr := repo.database.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", relationId).
+			First(&relation).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.NewError(errors.NotFound, "relationship not found", err)
+			}
+			return errors.NewError(errors.Internal, "error finding relationship", err)
+		}
+		if err := update(tx, &relation); err != nil {
+			if _, ok := err.(*errors.CustomError); ok {
+				return err
+			}
+			return errors.NewError(errors.Internal, "error updating relationship", err)
+		}
+		return tx.Preload("Coach").Preload("Client").Where("id = ?", relationId).First(&relation).Error
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+	return &relation, nil
+}
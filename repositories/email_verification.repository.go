@@ -0,0 +1,183 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/crypt"
+	"daily-diet-backend/utils/errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CreateEmailVerificationToken returns a new plain token bound to the email
+// address it is sent to, only its hash is stored
+func (repo *userRepository) CreateEmailVerificationToken(
+	c context.Context,
+	userId uuid.UUID,
+	email string,
+	ttl time.Duration,
+) (string, error) {
+	return repo.createEmailToken(c, userId, email, nil, ttl)
+}
+
+// CreateEmailChangeToken returns a new plain token confirming the pending
+// email of the user, every session but sessionId is revoked once it is used
+func (repo *userRepository) CreateEmailChangeToken(
+	c context.Context,
+	userId uuid.UUID,
+	email string,
+	sessionId *uuid.UUID,
+	ttl time.Duration,
+) (string, error) {
+	return repo.createEmailToken(c, userId, email, sessionId, ttl)
+}
+
+func (repo *userRepository) createEmailToken(
+	c context.Context,
+	userId uuid.UUID,
+	email string,
+	sessionId *uuid.UUID,
+	ttl time.Duration,
+) (string, error) {
+	plainToken, err := crypt.RandomToken()
+	if err != nil {
+		return "", errors.NewError(errors.Internal, "error generating verification token", err)
+	}
+	token := &models.EmailVerificationToken{
+		TokenHash: repo.hashToken(plainToken),
+		UserID:    userId,
+		Email:     email,
+		SessionID: sessionId,
+		ExpireAt:  time.Now().Add(ttl),
+	}
+	if err := repo.db.WithContext(c).Create(token).Error; err != nil {
+		return "", errors.NewError(errors.Internal, "error creating verification token", err)
+	}
+	return plainToken, nil
+}
+
+// CountEmailVerificationTokens returns how many verification tokens were
+// created for the user since a given time and when the latest one was created
+func (repo *userRepository) CountEmailVerificationTokens(
+	c context.Context,
+	userId uuid.UUID,
+	since time.Time,
+) (int64, *time.Time, error) {
+	var count int64
+	if err := repo.db.WithContext(c).
+		Model(&models.EmailVerificationToken{}).
+		Where("user_id = ? AND created_at >= ?", userId, since).
+		Count(&count).Error; err != nil {
+		return 0, nil, errors.NewError(errors.Internal, "error counting verification tokens", err)
+	}
+	if count == 0 {
+		return 0, nil, nil
+	}
+
+	var latest models.EmailVerificationToken
+	if err := repo.db.WithContext(c).
+		Where("user_id = ?", userId).
+		Order("created_at DESC").
+		First(&latest).Error; err != nil {
+		return 0, nil, errors.NewError(errors.Internal, "error finding verification token", err)
+	}
+	return count, &latest.CreatedAt, nil
+}
+
+// VerifyEmail consumes a verification token and marks the user as verified.
+// A token sent to the pending email of the user confirms the email change.
+func (repo *userRepository) VerifyEmail(c context.Context, token string) (*models.User, error) {
+	var user models.User
+	txErr := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var verification models.EmailVerificationToken
+		if err := tx.Where("token_hash = ?", repo.hashToken(token)).
+			First(&verification).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.NewError(errors.Invalid, "invalid or expired verification token", nil)
+			}
+			return errors.NewError(errors.Internal, "error finding verification token", err)
+		}
+		if verification.ExpireAt.Before(time.Now()) {
+			return errors.NewError(errors.Invalid, "invalid or expired verification token", nil)
+		}
+
+		result := tx.Model(&models.EmailVerificationToken{}).
+			Where("id = ? AND used_at IS NULL", verification.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return errors.NewError(errors.Internal, "error consuming verification token", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return errors.NewError(errors.Invalid, "invalid or expired verification token", nil)
+		}
+
+		if err := tx.Where("id = ?", verification.UserID).First(&user).Error; err != nil {
+			return errors.NewError(errors.Internal, "error finding user", err)
+		}
+		if user.PendingEmail != nil && *user.PendingEmail == verification.Email {
+			return confirmEmailChange(tx, c, &user, verification)
+		}
+		if user.Email != verification.Email {
+			return errors.NewError(errors.Invalid, "email changed since the token was sent", nil)
+		}
+		if user.VerifiedAt != nil {
+			return nil
+		}
+
+		now := time.Now()
+		if err := tx.Model(&user).Update("verified_at", now).Error; err != nil {
+			return errors.NewError(errors.Internal, "error verifying user", err)
+		}
+		user.VerifiedAt = &now
+		return nil
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+	return &user, nil
+}
+
+// confirmEmailChange replaces the email of the user with the confirmed pending
+// one and revokes every session except the one that asked for the change
+func confirmEmailChange(
+	tx *gorm.DB,
+	c context.Context,
+	user *models.User,
+	verification models.EmailVerificationToken,
+) error {
+	if err := checkEmailAvailable(tx, verification.Email); err != nil {
+		return err
+	}
+	previous := user.Email
+	now := time.Now()
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"email":         verification.Email,
+		"pending_email": nil,
+		"verified_at":   now,
+	}).Error; err != nil {
+		return errors.NewError(errors.Internal, "error changing email", err)
+	}
+	user.Email = verification.Email
+	user.PendingEmail = nil
+	user.VerifiedAt = &now
+
+	revoke := tx.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked = ?", user.ID, false)
+	if verification.SessionID != nil {
+		revoke = revoke.Where("family_id <> ?", *verification.SessionID)
+	}
+	if err := revoke.Updates(map[string]interface{}{
+		"revoked":    true,
+		"updated_at": now,
+	}).Error; err != nil {
+		return errors.NewError(errors.Internal, "error revoking refresh tokens", err)
+	}
+	return recordSecurityEvent(tx, c, &models.SecurityEvent{
+		UserID:  &user.ID,
+		Type:    models.SecurityEventEmailChanged,
+		Details: "previous email " + previous,
+	})
+}
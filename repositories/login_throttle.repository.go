@@ -0,0 +1,203 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/crypt"
+	"daily-diet-backend/utils/errors"
+	"daily-diet-backend/utils/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LoginThrottleOptions struct {
+	// Failed logins before an account or an IP is locked, 0 disables the limit
+	AccountMaxFailures int
+	IPMaxFailures      int
+	// Failed second factor codes before the second step of a user is locked
+	TwoFactorMaxFailures int
+	// First lockout, doubled for every further failure up to MaxLockout
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	// Failures are forgotten this long after the last failure or lockout
+	FailureWindow time.Duration
+}
+
+var errInvalidCredentials = errors.NewError(errors.Unauthorized, "invalid email or password", nil)
+
+var (
+	dummyPasswordHash     string
+	dummyPasswordHashOnce sync.Once
+)
+
+// compareDummyPassword spends the time of a bcrypt comparison for unknown
+// emails so response times do not reveal registered accounts
+func compareDummyPassword(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = crypt.HashPassword(uuid.NewString())
+	})
+	_ = crypt.ComparePassword(dummyPasswordHash, password)
+}
+
+func throttleAccountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkLoginThrottle fails with RateLimited while the account or the IP is locked
+func (repo *userRepository) checkLoginThrottle(c context.Context, email string, ip string) error {
+	var locked int64
+	query := repo.db.WithContext(c).
+		Model(&models.LoginThrottle{}).
+		Where("locked_until > ?", time.Now()).
+		Where(
+			repo.db.Where("scope = ? AND key = ?", models.LoginThrottleScopeAccount, throttleAccountKey(email)).
+				Or("scope = ? AND key = ?", models.LoginThrottleScopeIP, ip),
+		)
+	if err := query.Count(&locked).Error; err != nil {
+		return errors.NewError(errors.Internal, "error checking login attempts", err)
+	}
+	if locked > 0 {
+		return errors.NewError(errors.RateLimited, "too many failed login attempts, try again later", nil)
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed login for the account and the IP and
+// locks them once they reach their limit
+func (repo *userRepository) recordLoginFailure(c context.Context, email string, ip string, userId *uuid.UUID) {
+	err := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := repo.countLoginFailure(tx, c, models.LoginThrottleScopeAccount, throttleAccountKey(email),
+			repo.loginThrottle.AccountMaxFailures, userId); err != nil {
+			return err
+		}
+		if ip == "" {
+			return nil
+		}
+		return repo.countLoginFailure(tx, c, models.LoginThrottleScopeIP, ip, repo.loginThrottle.IPMaxFailures, nil)
+	})
+	if err != nil {
+		logger.Log(logger.ERROR, "Error recording failed login: "+err.Error())
+	}
+}
+
+func (repo *userRepository) countLoginFailure(
+	tx *gorm.DB,
+	c context.Context,
+	scope string,
+	key string,
+	maxFailures int,
+	userId *uuid.UUID,
+) error {
+	if maxFailures <= 0 {
+		return nil
+	}
+	if err := tx.WithContext(c).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.LoginThrottle{Scope: scope, Key: key}).Error; err != nil {
+		return errors.NewError(errors.Internal, "error recording failed login", err)
+	}
+	var throttle models.LoginThrottle
+	if err := tx.WithContext(c).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("scope = ? AND key = ?", scope, key).
+		First(&throttle).Error; err != nil {
+		return errors.NewError(errors.Internal, "error recording failed login", err)
+	}
+
+	now := time.Now()
+	if failuresExpired(&throttle, now, repo.loginThrottle.FailureWindow) {
+		throttle.Failures = 0
+		throttle.LockedUntil = nil
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = &now
+
+	var lockout time.Duration
+	if throttle.Failures >= maxFailures {
+		lockout = repo.lockoutDuration(throttle.Failures - maxFailures)
+		lockedUntil := now.Add(lockout)
+		throttle.LockedUntil = &lockedUntil
+	}
+	if err := tx.Save(&throttle).Error; err != nil {
+		return errors.NewError(errors.Internal, "error recording failed login", err)
+	}
+
+	if lockout > 0 {
+		logger.Log(logger.WARNING, "Login locked for "+scope+" "+key+" after "+fmt.Sprint(throttle.Failures)+" failures")
+		return recordSecurityEvent(tx, c, &models.SecurityEvent{
+			UserID:  userId,
+			Type:    models.SecurityEventLoginLockout,
+			Details: fmt.Sprintf("%s %s locked for %s after %d failed logins", scope, key, lockout, throttle.Failures),
+		})
+	}
+	return nil
+}
+
+// failuresExpired tells if the counted failures are older than window. The
+// window runs from the end of the last lockout, otherwise the counter would
+// be forgotten while locked and the backoff would never grow.
+func failuresExpired(throttle *models.LoginThrottle, now time.Time, window time.Duration) bool {
+	lastActivity := throttle.LastFailureAt
+	if throttle.LockedUntil != nil && (lastActivity == nil || throttle.LockedUntil.After(*lastActivity)) {
+		lastActivity = throttle.LockedUntil
+	}
+	return lastActivity != nil && now.Sub(*lastActivity) > window
+}
+
+// lockoutDuration doubles BaseLockout for every failure over the limit
+func (repo *userRepository) lockoutDuration(overLimit int) time.Duration {
+	lockout := repo.loginThrottle.BaseLockout
+	for i := 0; i < overLimit && lockout < repo.loginThrottle.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > repo.loginThrottle.MaxLockout {
+		return repo.loginThrottle.MaxLockout
+	}
+	return lockout
+}
+
+// checkTwoFactorThrottle fails with RateLimited while the second step of the
+// user is locked
+func (repo *userRepository) checkTwoFactorThrottle(c context.Context, userId uuid.UUID) error {
+	var locked int64
+	if err := repo.db.WithContext(c).
+		Model(&models.LoginThrottle{}).
+		Where("scope = ? AND key = ? AND locked_until > ?", models.LoginThrottleScopeTwoFactor, userId.String(), time.Now()).
+		Count(&locked).Error; err != nil {
+		return errors.NewError(errors.Internal, "error checking login attempts", err)
+	}
+	if locked > 0 {
+		return errors.NewError(errors.RateLimited, "too many invalid codes, try again later", nil)
+	}
+	return nil
+}
+
+// recordTwoFactorFailure counts an invalid second factor code of the user
+func (repo *userRepository) recordTwoFactorFailure(c context.Context, userId uuid.UUID) {
+	err := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		return repo.countLoginFailure(tx, c, models.LoginThrottleScopeTwoFactor, userId.String(),
+			repo.loginThrottle.TwoFactorMaxFailures, &userId)
+	})
+	if err != nil {
+		logger.Log(logger.ERROR, "Error recording failed second factor: "+err.Error())
+	}
+}
+
+// resetLoginFailures clears the account and second factor counters once a
+// whole login succeeded, the IP counter is kept so one valid account cannot
+// unlock an attacking IP
+func (repo *userRepository) resetLoginFailures(c context.Context, user *models.User) {
+	if err := repo.db.WithContext(c).
+		Where("scope = ? AND key = ?", models.LoginThrottleScopeAccount, throttleAccountKey(user.Email)).
+		Or("scope = ? AND key = ?", models.LoginThrottleScopeTwoFactor, user.ID.String()).
+		Delete(&models.LoginThrottle{}).Error; err != nil {
+		logger.Log(logger.ERROR, "Error resetting failed logins: "+err.Error())
+	}
+}
@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"daily-diet-backend/models"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	repo := &userRepository{loginThrottle: LoginThrottleOptions{
+		BaseLockout: time.Minute,
+		MaxLockout:  time.Hour,
+	}}
+	tests := []struct {
+		overLimit int
+		want      time.Duration
+	}{
+		{0, time.Minute},
+		{1, 2 * time.Minute},
+		{2, 4 * time.Minute},
+		{5, 32 * time.Minute},
+		{6, time.Hour},
+		{100, time.Hour},
+	}
+	for _, test := range tests {
+		if got := repo.lockoutDuration(test.overLimit); got != test.want {
+			t.Errorf("lockoutDuration(%d) = %s, want %s", test.overLimit, got, test.want)
+		}
+	}
+}
+
+func TestLockoutDurationBaseOverMax(t *testing.T) {
+	repo := &userRepository{loginThrottle: LoginThrottleOptions{
+		BaseLockout: 2 * time.Hour,
+		MaxLockout:  time.Hour,
+	}}
+	if got := repo.lockoutDuration(0); got != time.Hour {
+		t.Errorf("lockoutDuration(0) = %s, want %s", got, time.Hour)
+	}
+}
+
+func TestFailuresExpired(t *testing.T) {
+	now := time.Now()
+	window := 15 * time.Minute
+	at := func(offset time.Duration) *time.Time {
+		moment := now.Add(offset)
+		return &moment
+	}
+
+	tests := []struct {
+		name     string
+		throttle models.LoginThrottle
+		want     bool
+	}{
+		{"no failure yet", models.LoginThrottle{}, false},
+		{"recent failure", models.LoginThrottle{LastFailureAt: at(-time.Minute)}, false},
+		{"old failure", models.LoginThrottle{LastFailureAt: at(-time.Hour)}, true},
+		{
+			"locked longer than the window",
+			models.LoginThrottle{LastFailureAt: at(-time.Hour), LockedUntil: at(10 * time.Minute)},
+			false,
+		},
+		{
+			"lockout ended within the window",
+			models.LoginThrottle{LastFailureAt: at(-2 * time.Hour), LockedUntil: at(-5 * time.Minute)},
+			false,
+		},
+		{
+			"lockout ended before the window",
+			models.LoginThrottle{LastFailureAt: at(-2 * time.Hour), LockedUntil: at(-time.Hour)},
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := failuresExpired(&test.throttle, now, window); got != test.want {
+				t.Errorf("failuresExpired() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
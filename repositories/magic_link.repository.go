@@ -0,0 +1,156 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/crypt"
+	"daily-diet-backend/utils/errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CreateMagicLinkToken invalidates pending magic links of the user and
+// returns a new plain token bound to deviceId, only its hash is stored
+func (repo *userRepository) CreateMagicLinkToken(
+	c context.Context,
+	userId uuid.UUID,
+	deviceId string,
+	ttl time.Duration,
+) (string, error) {
+	plainToken, err := crypt.RandomToken()
+	if err != nil {
+		return "", errors.NewError(errors.Internal, "error generating magic link", err)
+	}
+
+	txErr := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.MagicLinkToken{}).
+			Where("user_id = ? AND used_at IS NULL", userId).
+			Update("used_at", time.Now()).Error; err != nil {
+			return errors.NewError(errors.Internal, "error invalidating magic links", err)
+		}
+		magicLink := &models.MagicLinkToken{
+			TokenHash: repo.hashToken(plainToken),
+			UserID:    userId,
+			DeviceID:  deviceId,
+			ExpireAt:  time.Now().Add(ttl),
+		}
+		if err := tx.Create(magicLink).Error; err != nil {
+			return errors.NewError(errors.Internal, "error creating magic link", err)
+		}
+		return nil
+	})
+	if txErr != nil {
+		return "", txErr
+	}
+	return plainToken, nil
+}
+
+// ConsumeMagicLinkToken uses up a magic link presented by deviceId and
+// returns its user. Opening the link proves the email, an unverified user
+// becomes verified.
+func (repo *userRepository) ConsumeMagicLinkToken(c context.Context, token string, deviceId string) (*models.User, error) {
+	var user models.User
+	txErr := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var magicLink models.MagicLinkToken
+		if err := tx.Where("token_hash = ?", repo.hashToken(token)).
+			First(&magicLink).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.NewError(errors.Invalid, "invalid or expired magic link", nil)
+			}
+			return errors.NewError(errors.Internal, "error finding magic link", err)
+		}
+		if magicLink.UsedAt != nil || magicLink.ExpireAt.Before(time.Now()) {
+			return errors.NewError(errors.Invalid, "invalid or expired magic link", nil)
+		}
+		// not consumed, the device that asked for the link can still use it
+		if magicLink.DeviceID != deviceId {
+			return errors.NewError(errors.Unauthorized, "the magic link was requested from another device", nil)
+		}
+
+		// single use, a concurrent exchange with the same token loses here
+		result := tx.Model(&models.MagicLinkToken{}).
+			Where("id = ? AND used_at IS NULL", magicLink.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return errors.NewError(errors.Internal, "error consuming magic link", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return errors.NewError(errors.Invalid, "invalid or expired magic link", nil)
+		}
+
+		if err := tx.Where("id = ?", magicLink.UserID).First(&user).Error; err != nil {
+			return errors.NewError(errors.Internal, "error finding user in database", err)
+		}
+		if user.DisabledAt != nil {
+			return errors.NewError(errors.Forbidden, "account disabled", nil)
+		}
+		if user.VerifiedAt == nil {
+			now := time.Now()
+			if err := tx.Model(&user).Update("verified_at", now).Error; err != nil {
+				return errors.NewError(errors.Internal, "error verifying email", err)
+			}
+			user.VerifiedAt = &now
+		}
+		return nil
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+	return &user, nil
+}
+
+// RecordMagicLinkRequest stores a request and returns how many requests the
+// email and the IP made since, including this one, and when the email last
+// asked before. Records older than since are deleted on the way.
+func (repo *userRepository) RecordMagicLinkRequest(
+	c context.Context,
+	email string,
+	clientIP string,
+	since time.Time,
+) (int64, *time.Time, int64, error) {
+	emailHash := repo.hashToken(strings.ToLower(email))
+	var emailCount, ipCount int64
+	var previous *time.Time
+	txErr := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("created_at < ?", since).
+			Delete(&models.MagicLinkRequest{}).Error; err != nil {
+			return errors.NewError(errors.Internal, "error deleting old magic link requests", err)
+		}
+
+		var latest []models.MagicLinkRequest
+		if err := tx.Where("email_hash = ?", emailHash).
+			Order("created_at DESC").Limit(1).
+			Find(&latest).Error; err != nil {
+			return errors.NewError(errors.Internal, "error finding magic link requests", err)
+		}
+		if len(latest) > 0 {
+			previous = &latest[0].CreatedAt
+		}
+
+		if err := tx.Create(&models.MagicLinkRequest{
+			EmailHash: emailHash,
+			ClientIP:  clientIP,
+		}).Error; err != nil {
+			return errors.NewError(errors.Internal, "error recording magic link request", err)
+		}
+		if err := tx.Model(&models.MagicLinkRequest{}).
+			Where("email_hash = ? AND created_at >= ?", emailHash, since).
+			Count(&emailCount).Error; err != nil {
+			return errors.NewError(errors.Internal, "error counting magic link requests", err)
+		}
+		if err := tx.Model(&models.MagicLinkRequest{}).
+			Where("client_ip = ? AND created_at >= ?", clientIP, since).
+			Count(&ipCount).Error; err != nil {
+			return errors.NewError(errors.Internal, "error counting magic link requests", err)
+		}
+		return nil
+	})
+	if txErr != nil {
+		return 0, nil, 0, txErr
+	}
+	return emailCount, previous, ipCount, nil
+}
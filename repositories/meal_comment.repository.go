@@ -0,0 +1,187 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type MealCommentRepository interface {
+	ListComments(c context.Context, mealId string, viewerId uuid.UUID) ([]models.MealComment, error)
+	CreateComment(c context.Context, mealId string, authorId uuid.UUID, data models.CreateMealCommentDTO) (*models.MealComment, error)
+}
+
+type mealCommentRepository struct {
+	database *gorm.DB
+}
+
+func NewMealCommentRepository(client *gorm.DB) MealCommentRepository {
+	return &mealCommentRepository{database: client}
+}
+
+// findCommentedMeal loads a meal for its comments, the viewer must be the
+// owner or a coach of the owner with the meals:read scope
+func findCommentedMeal(db *gorm.DB, c context.Context, mealId string, viewerId uuid.UUID) (*models.Meal, error) {
+	var meal models.Meal
+	if err := db.WithContext(c).Where("id = ?", mealId).First(&meal).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewError(errors.NotFound, "no meal with id -> "+mealId, err)
+		}
+		return nil, errors.NewError(errors.Internal, "could not find meal with id ->"+mealId, err)
+	}
+	if err := checkReadAccess(db, c, viewerId, meal.UserID, models.ScopeMealsRead); err != nil {
+		return nil, err
+	}
+	return &meal, nil
+}
+
+// ListComments returns the comments of a meal oldest first, marking the ones
+// written by others as read when the owner lists them
+func (repo *mealCommentRepository) ListComments(
+	c context.Context,
+	mealId string,
+	viewerId uuid.UUID,
+) ([]models.MealComment, error) {
+	meal, err := findCommentedMeal(repo.database, c, mealId, viewerId)
+	if err != nil {
+		return nil, err
+	}
+
+	if meal.UserID == viewerId {
+		if err := repo.database.WithContext(c).
+			Model(&models.MealComment{}).
+			Where("meal_id = ? AND author_id <> ? AND read_at IS NULL", meal.ID, viewerId).
+			Update("read_at", time.Now()).Error; err != nil {
+			return nil, errors.NewError(errors.Internal, "error marking comments as read", err)
+		}
+	}
+
+	var comments []models.MealComment
+	if err := repo.database.WithContext(c).
+		Preload("Author").
+		Where("meal_id = ?", meal.ID).
+		Order("created_at ASC").Order("id ASC").
+		Find(&comments).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error listing comments", err)
+	}
+	return comments, nil
+}
+
+// CreateComment adds a comment to a meal. A verdict can only be given by a
+// coach granted meals:verdict, it is stored as the coach verdict of the meal
+// and wins over the flag of the owner. An explicit null verdict clears it,
+// which the owner may do too.
+func (repo *mealCommentRepository) CreateComment(
+	c context.Context,
+	mealId string,
+	authorId uuid.UUID,
+	data models.CreateMealCommentDTO,
+) (*models.MealComment, error) {
+	var comment *models.MealComment
+	txErr := repo.database.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		meal, err := findCommentedMeal(tx, c, mealId, authorId)
+		if err != nil {
+			return err
+		}
+		isOwner := meal.UserID == authorId
+		giving := data.Verdict.Set && data.Verdict.Value != nil
+		clearing := data.Verdict.Set && data.Verdict.Value == nil
+		if giving && isOwner {
+			return errors.NewError(errors.Forbidden, "only a coach can give a verdict on a meal", nil)
+		}
+		if data.Verdict.Set && !isOwner {
+			if err := checkReadAccess(tx, c, authorId, meal.UserID, models.ScopeMealsVerdict); err != nil {
+				if customErr, ok := err.(*errors.CustomError); ok && customErr.Type == errors.Forbidden {
+					return errors.NewError(errors.Forbidden, "the client did not allow you to give verdicts", nil)
+				}
+				return err
+			}
+		}
+
+		comment = &models.MealComment{
+			MealID:   meal.ID,
+			AuthorID: authorId,
+			Body:     data.Body,
+			Verdict:  data.Verdict.Value,
+			// nothing to clear is not worth flagging
+			VerdictCleared: clearing && meal.ActiveCoachVerdict() != nil,
+		}
+		if isOwner {
+			// the owner has obviously read their own comment
+			now := time.Now()
+			comment.ReadAt = &now
+		}
+		if err := tx.Create(comment).Error; err != nil {
+			return errors.NewError(errors.Internal, "error creating comment", err)
+		}
+
+		if data.Verdict.Set {
+			before := meal.EffectiveInDiet()
+			var verdictBy *uuid.UUID
+			if giving {
+				verdictBy = &authorId
+			}
+			if err := tx.Model(meal).Updates(map[string]interface{}{
+				"coach_verdict":    data.Verdict.Value,
+				"coach_verdict_by": verdictBy,
+			}).Error; err != nil {
+				return errors.NewError(errors.Internal, "error updating meal", err)
+			}
+			meal.CoachVerdict, meal.CoachVerdictBy = data.Verdict.Value, verdictBy
+			if meal.EffectiveInDiet() != before {
+				if _, err := RecomputeUserStats(tx, c, meal.UserID); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := tx.Preload("Author").First(comment, "id = ?", comment.ID).Error; err != nil {
+			return errors.NewError(errors.Internal, "error loading comment", err)
+		}
+		return nil
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+	return comment, nil
+}
+
+// countUnreadComments counts per meal the comments of others the owner has
+// not read yet
+func countUnreadComments(
+	db *gorm.DB,
+	c context.Context,
+	ownerId uuid.UUID,
+	meals []models.Meal,
+) (map[uuid.UUID]int64, error) {
+	counts := make(map[uuid.UUID]int64)
+	if len(meals) == 0 {
+		return counts, nil
+	}
+	ids := make([]uuid.UUID, 0, len(meals))
+	for _, meal := range meals {
+		ids = append(ids, meal.ID)
+	}
+
+	var rows []struct {
+		MealID uuid.UUID
+		Unread int64
+	}
+	if err := db.WithContext(c).
+		Model(&models.MealComment{}).
+		Select("meal_id, COUNT(*) AS unread").
+		Where("meal_id IN ? AND author_id <> ? AND read_at IS NULL", ids, ownerId).
+		Group("meal_id").
+		Scan(&rows).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error counting unread comments", err)
+	}
+	for _, row := range rows {
+		counts[row.MealID] = row.Unread
+	}
+	return counts, nil
+}
@@ -2,21 +2,27 @@ package repositories
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"daily-diet-backend/models"
 	"daily-diet-backend/utils/errors"
 	"daily-diet-backend/utils/logger"
+	"daily-diet-backend/utils/pagination"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type MealsRepository interface {
-	GetMeals(c context.Context, userId uuid.UUID) ([]models.Meal, error)
+	GetMeals(c context.Context, viewerId uuid.UUID, ownerId uuid.UUID, query models.ListMealsQuery) (*models.MealsPage, error)
 	CreateMeal(c context.Context, data models.CreateMealDTO, userId uuid.UUID) (*models.Meal, error)
 	DeleteMeal(c context.Context, mealId string, userId uuid.UUID) error
 	EditMeal(c context.Context, mealId string, userId uuid.UUID, data models.EditMealDTO) (*models.Meal, error)
 	GetMeal(c context.Context, mealId string, userId uuid.UUID) (*models.Meal, error)
+	GetTimeline(c context.Context, userId uuid.UUID, query models.TimelineQuery) (*models.Timeline, error)
+	ListTags(c context.Context, userId uuid.UUID, query models.ListTagsQuery) ([]models.TagUsage, error)
+	GetMacroTotals(c context.Context, userId uuid.UUID, period string, from time.Time, to time.Time) ([]models.MacroTotals, error)
 }
 
 type mealsRepository struct {
@@ -27,15 +33,116 @@ func NewMealsRepository(client *gorm.DB) MealsRepository {
 	return &mealsRepository{database: client}
 }
 
+// GetMeals lists the meals of ownerId as seen by viewerId, the owner or a
+// coach with the meals:read scope
 func (repo *mealsRepository) GetMeals(
 	c context.Context,
-	userId uuid.UUID,
-) ([]models.Meal, error) {
+	viewerId uuid.UUID,
+	ownerId uuid.UUID,
+	query models.ListMealsQuery,
+) (*models.MealsPage, error) {
+	if err := checkReadAccess(repo.database, c, viewerId, ownerId, models.ScopeMealsRead); err != nil {
+		return nil, err
+	}
+	limit := pagination.NormalizeLimit(query.Limit)
+	sortBy := query.SortBy
+	if sortBy == "" {
+		sortBy = models.MealSortByDate
+	}
+	order := query.Order
+	if order == "" {
+		order = models.SortOrderDesc
+	}
+	// keyset comparison operator follows the sort direction
+	comparator := "<"
+	if order == models.SortOrderAsc {
+		comparator = ">"
+	}
+
+	db := repo.database.WithContext(c).Where("user_id = ?", ownerId)
+	if query.From != nil {
+		db = db.Where("date >= ?", *query.From)
+	}
+	if query.To != nil {
+		// include the whole "to" day
+		db = db.Where("date < ?", query.To.AddDate(0, 0, 1))
+	}
+	if query.InDiet != nil {
+		db = db.Where(models.EffectiveInDietSQL+" = ?", *query.InDiet)
+	}
+	if query.Name != "" {
+		db = db.Where("name ILIKE ?", "%"+escapeLike(query.Name)+"%")
+	}
+	if query.MealType != "" {
+		db = db.Where("meal_type = ?", query.MealType)
+	}
+	if len(query.Tags) > 0 {
+		db = filterByTags(db, ownerId, query.Tags, query.TagMatch == models.TagMatchAll)
+	}
+
+	if query.Cursor != "" {
+		cursor, err := pagination.Decode(query.Cursor)
+		if err != nil {
+			return nil, errors.NewError(errors.Invalid, "invalid cursor", err)
+		}
+		switch sortBy {
+		case models.MealSortByCreatedAt:
+			if cursor.CreatedAt == nil {
+				return nil, errors.NewError(errors.Invalid, "cursor does not match sort_by", nil)
+			}
+			db = db.Where("(created_at, id) "+comparator+" (?, ?)", *cursor.CreatedAt, cursor.ID)
+		default:
+			if cursor.Date == nil || cursor.Time == nil {
+				return nil, errors.NewError(errors.Invalid, "cursor does not match sort_by", nil)
+			}
+			db = db.Where("(date, time, id) "+comparator+" (?, ?, ?)", *cursor.Date, *cursor.Time, cursor.ID)
+		}
+	}
+
+	switch sortBy {
+	case models.MealSortByCreatedAt:
+		db = db.Order("created_at " + order).Order("id " + order)
+	default:
+		db = db.Order("date " + order).Order("time " + order).Order("id " + order)
+	}
+
+	// fetch one extra row to know if there is a next page
 	var meals []models.Meal
-	if err := repo.database.WithContext(c).Where("user_id = ?", userId).Find(&meals).Error; err != nil {
+	if err := db.Preload("Tags", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("name ASC")
+	}).Limit(limit + 1).Find(&meals).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error listing meals", err)
+	}
+
+	response := &models.MealsPage{Meals: meals}
+	if len(meals) > limit {
+		response.Meals = meals[:limit]
+		last := response.Meals[limit-1]
+		next := pagination.Cursor{ID: last.ID}
+		if sortBy == models.MealSortByCreatedAt {
+			next.CreatedAt = &last.CreatedAt
+		} else {
+			next.Date = &last.Date
+			next.Time = &last.Time
+		}
+		encoded, err := pagination.Encode(next)
+		if err != nil {
+			return nil, errors.NewError(errors.Internal, "error encoding cursor", err)
+		}
+		response.NextCursor = &encoded
+	}
+
+	unread, err := countUnreadComments(repo.database, c, ownerId, response.Meals)
+	if err != nil {
 		return nil, err
 	}
-	return meals, nil
+	response.UnreadComments = unread
+	return response, nil
+}
+
+// escapeLike escapes the LIKE wildcards so user input is matched literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
 }
 
 func (repo *mealsRepository) CreateMeal(
@@ -45,27 +152,41 @@ func (repo *mealsRepository) CreateMeal(
 	var meal *models.Meal
 	var txErr error
 
-	txErr = repo.database.Transaction(
+	txErr = repo.database.WithContext(c).Transaction(
 		func(tx *gorm.DB) error {
 			meal = &models.Meal{
-				Name:   data.Name,
-				UserID: userId,
-				Date:   data.Date,
-				Time:   data.Time,
-				InDiet: data.InDiet,
+				Name:     data.Name,
+				UserID:   userId,
+				Date:     data.Date,
+				Time:     data.Time,
+				InDiet:   data.InDiet,
+				Calories: data.Calories,
+				Protein:  data.Protein,
+				Carbs:    data.Carbs,
+				Fat:      data.Fat,
+				Fiber:    data.Fiber,
 			}
 
 			if data.Description != nil {
 				meal.Description = *data.Description
 			}
+			if data.MealType != nil {
+				meal.MealType = *data.MealType
+			} else {
+				meal.MealType = models.InferMealType(data.Time)
+			}
 
 			if err := tx.Create(meal).Error; err != nil {
-				txErr = err
 				return err // rollback
 			}
 
-			if err := repo.handlePostCreate(tx, c, data, userId); err != nil {
-				txErr = err
+			if len(data.Tags) > 0 {
+				if err := setMealTags(tx, c, meal, data.Tags); err != nil {
+					return err // rollback
+				}
+			}
+
+			if _, err := RecomputeUserStats(tx, c, userId); err != nil {
 				return err // rollback
 			}
 
@@ -79,148 +200,43 @@ func (repo *mealsRepository) CreateMeal(
 	return meal, nil
 }
 
-func (repo *mealsRepository) handlePostCreate(
-	tx *gorm.DB,
-	c context.Context,
-	data models.CreateMealDTO,
-	userId uuid.UUID,
-) error {
-	var existingUser models.User
-	if err := tx.WithContext(c).First(&existingUser, userId).Error; err != nil {
-		logger.Log(logger.ERROR, "Error finding user: "+err.Error())
-		return err
-	}
-
-	// Find or create stats
-	var stats models.UserStats
-	result := tx.WithContext(c).Where("user_id = ?", userId).First(&stats)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			stats = models.UserStats{
-				UserID: userId,
-				CurrentStreak: stats.UpdateCurrentStreak(
-					data.InDiet, 0,
-				),
-				MaxStreak: stats.UpdateMaxStreak(
-					data.InDiet,
-					0,
-					0,
-				),
-				InDietMeals: stats.UpdateInDietMeals(
-					data.InDiet,
-					true,
-					false,
-					false,
-					0,
-				),
-				RegisteredMeals: 1,
-			}
-			if err := tx.Create(&stats).Error; err != nil {
-				return err
-			}
-		} else {
-			return result.Error
-		}
-	} else {
-		// Update stats
-		stats.InDietMeals = stats.UpdateInDietMeals(
-			data.InDiet,
-			true,
-			false,
-			false,
-			stats.InDietMeals,
-		)
-		stats.RegisteredMeals = stats.UpdateRegisteredMeals(
-			true,
-			stats.RegisteredMeals,
-		)
-		stats.MaxStreak = stats.UpdateMaxStreak(
-			data.InDiet,
-			stats.MaxStreak,
-			stats.CurrentStreak,
-		)
-		stats.CurrentStreak = stats.UpdateCurrentStreak(
-			data.InDiet,
-			stats.CurrentStreak,
-		)
-		if err := tx.Save(&stats).Error; err != nil {
-			return err
-		}
-	}
-
-	// Update associations
-	return tx.Save(&existingUser).Error
-}
-
 func (repo *mealsRepository) DeleteMeal(
 	c context.Context,
 	mealId string,
 	userId uuid.UUID,
 ) error {
-	var toDeleteMeal models.Meal
-	if err := repo.database.WithContext(c).
-		Where("id = ?", mealId).
-		First(&toDeleteMeal).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	return repo.database.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var toDeleteMeal models.Meal
+		if err := tx.
+			Where("id = ? AND user_id = ?", mealId, userId).
+			First(&toDeleteMeal).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.NewError(
+					errors.NotFound,
+					"no meal with id -> "+mealId, err,
+				)
+			}
 			return errors.NewError(
-				errors.NotFound,
-				"no meal with id -> "+mealId, err,
+				errors.Internal,
+				"could not find meal with id ->"+mealId,
+				err,
 			)
 		}
-		return errors.NewError(
-			errors.Internal,
-			"could not find meal with id ->"+mealId,
-			err,
-		)
-	}
 
-	var existingStats models.UserStats
-	err := repo.database.Where("user_id = ?", userId).First(&existingStats).Error
+		if err := tx.Delete(&toDeleteMeal).Error; err != nil {
+			return errors.NewError(
+				errors.Internal,
+				"error deleting meal",
+				err,
+			)
+		}
 
-	if err != nil {
-		if err != gorm.ErrRecordNotFound {
-			logger.Log(logger.ERROR, "Error finding user stats")
-			logger.Log(logger.ERROR, err.Error())
+		if _, err := RecomputeUserStats(tx, c, userId); err != nil {
 			return err
 		}
-		logger.Log(logger.INFO, "No stats found, initializing with zero values")
-	} else {
-	}
-
-	if err := repo.database.WithContext(c).Delete(&toDeleteMeal).Error; err != nil {
-		return err
-	}
 
-	// update stats
-	existingStats.InDietMeals = existingStats.UpdateInDietMeals(
-		toDeleteMeal.InDiet,
-		false,
-		true,
-		toDeleteMeal.InDiet,
-		existingStats.InDietMeals,
-	)
-	existingStats.RegisteredMeals = existingStats.UpdateRegisteredMeals(
-		false,
-		existingStats.RegisteredMeals,
-	)
-	existingStats.MaxStreak = existingStats.UpdateMaxStreak(
-		toDeleteMeal.InDiet,
-		existingStats.MaxStreak,
-		existingStats.CurrentStreak,
-	)
-	existingStats.CurrentStreak = existingStats.UpdateCurrentStreak(
-		toDeleteMeal.InDiet,
-		existingStats.CurrentStreak,
-	)
-	if err := repo.database.Save(&existingStats).Error; err != nil {
-		return errors.NewError(
-			errors.Internal,
-			"error updating user stats on delete -> ",
-			err,
-		)
-	}
-
-	return nil
+		return nil
+	})
 }
 
 func (repo *mealsRepository) EditMeal(
@@ -232,8 +248,8 @@ func (repo *mealsRepository) EditMeal(
 	var toEditMeal *models.Meal
 	var txErr error
 
-	txErr = repo.database.Transaction(func(tx *gorm.DB) error {
-		if err := tx.WithContext(c).
+	txErr = repo.database.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.
 			Where("id = ?", mealId).
 			First(&toEditMeal).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
@@ -258,8 +274,6 @@ func (repo *mealsRepository) EditMeal(
 			)
 		}
 
-		oldInDiet := toEditMeal.InDiet
-
 		if data.Name != nil {
 			toEditMeal.Name = *data.Name
 		}
@@ -275,6 +289,41 @@ func (repo *mealsRepository) EditMeal(
 		if data.InDiet != nil {
 			toEditMeal.InDiet = *data.InDiet
 		}
+		if data.MealType != nil {
+			toEditMeal.MealType = *data.MealType
+		} else if data.Time != nil {
+			// a moved meal gets the type of its new time, like a new one
+			toEditMeal.MealType = models.InferMealType(*data.Time)
+		}
+		if data.Calories != nil {
+			toEditMeal.Calories = data.Calories
+		}
+		if data.Protein != nil {
+			toEditMeal.Protein = data.Protein
+		}
+		if data.Carbs != nil {
+			toEditMeal.Carbs = data.Carbs
+		}
+		if data.Fat != nil {
+			toEditMeal.Fat = data.Fat
+		}
+		if data.Fiber != nil {
+			toEditMeal.Fiber = data.Fiber
+		}
+		for _, macro := range data.ClearMacros {
+			switch macro {
+			case "calories":
+				toEditMeal.Calories = nil
+			case "protein":
+				toEditMeal.Protein = nil
+			case "carbs":
+				toEditMeal.Carbs = nil
+			case "fat":
+				toEditMeal.Fat = nil
+			case "fiber":
+				toEditMeal.Fiber = nil
+			}
+		}
 
 		if err := tx.Save(&toEditMeal).Error; err != nil {
 			return errors.NewError(
@@ -284,41 +333,21 @@ func (repo *mealsRepository) EditMeal(
 			)
 		}
 
-		// Update stats if InDiet value changed
-		if data.InDiet != nil && oldInDiet != *data.InDiet {
-			var stats models.UserStats
-			if err := tx.Where("user_id = ?", userId).First(&stats).Error; err != nil {
-				return errors.NewError(
-					errors.Internal,
-					"error finding user stats",
-					err,
-				)
+		if data.Tags != nil {
+			if err := setMealTags(tx, c, toEditMeal, *data.Tags); err != nil {
+				return err
 			}
-
-			stats.InDietMeals = stats.UpdateInDietMeals(
-				*data.InDiet,
-				false,
-				false,
-				oldInDiet,
-				stats.InDietMeals,
-			)
-			stats.MaxStreak = stats.UpdateMaxStreak(
-				*data.InDiet,
-				stats.MaxStreak,
-				stats.CurrentStreak,
-			)
-			stats.CurrentStreak = stats.UpdateCurrentStreak(
-				*data.InDiet,
-				stats.CurrentStreak,
-			)
-
-			if err := tx.Save(&stats).Error; err != nil {
-				return errors.NewError(
-					errors.Internal,
-					"error updating user stats",
-					err,
-				)
+		} else {
+			edited := []models.Meal{*toEditMeal}
+			if err := loadMealTags(tx, c, edited); err != nil {
+				return err
 			}
+			toEditMeal.Tags = edited[0].Tags
+		}
+
+		// InDiet, Date and Time all affect the streaks
+		if _, err := RecomputeUserStats(tx, c, userId); err != nil {
+			return err
 		}
 
 		return nil
@@ -338,6 +367,9 @@ func (repo *mealsRepository) GetMeal(
 ) (*models.Meal, error) {
 	var meal *models.Meal
 	if err := repo.database.WithContext(c).
+		Preload("Tags", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("name ASC")
+		}).
 		Where("id = ? AND user_id = ?", mealId, userId).
 		First(&meal).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -355,3 +387,106 @@ func (repo *mealsRepository) GetMeal(
 	}
 	return meal, nil
 }
+
+const dayLayout = "2006-01-02"
+
+// dayMeal is a meal together with the day it is grouped under
+type dayMeal struct {
+	models.Meal
+	Day string
+}
+
+// dayAggregate is a row of the per day aggregation used by GetTimeline
+type dayAggregate struct {
+	Day              string
+	TotalMeals       int
+	InDietMeals      int
+	InDietPercentage float64
+}
+
+func (repo *mealsRepository) GetTimeline(
+	c context.Context,
+	userId uuid.UUID,
+	query models.TimelineQuery,
+) (*models.Timeline, error) {
+	limit := pagination.NormalizeLimit(query.Limit)
+
+	db := repo.database.WithContext(c).
+		Model(&models.Meal{}).
+		Select(`TO_CHAR(date, 'YYYY-MM-DD') AS day,
+			COUNT(*) AS total_meals,
+			COUNT(*) FILTER (WHERE `+models.EffectiveInDietSQL+`) AS in_diet_meals,
+			ROUND(100.0 * COUNT(*) FILTER (WHERE `+models.EffectiveInDietSQL+`) / COUNT(*), 2) AS in_diet_percentage`).
+		Where("user_id = ?", userId)
+
+	if query.Cursor != "" {
+		cursor, err := pagination.Decode(query.Cursor)
+		if err != nil || cursor.Date == nil {
+			return nil, errors.NewError(errors.Invalid, "invalid cursor", err)
+		}
+		db = db.Where("TO_CHAR(date, 'YYYY-MM-DD') < ?", cursor.Date.Format(dayLayout))
+	}
+
+	// fetch one extra day to know if there is a next page
+	var days []dayAggregate
+	if err := db.Group("day").Order("day DESC").Limit(limit + 1).Scan(&days).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error aggregating meals by day", err)
+	}
+
+	response := &models.Timeline{Days: []models.MealDay{}}
+	if len(days) > limit {
+		days = days[:limit]
+		lastDay, err := time.Parse(dayLayout, days[limit-1].Day)
+		if err != nil {
+			return nil, errors.NewError(errors.Internal, "error parsing day", err)
+		}
+		next, err := pagination.Encode(pagination.Cursor{Date: &lastDay})
+		if err != nil {
+			return nil, errors.NewError(errors.Internal, "error encoding cursor", err)
+		}
+		response.NextCursor = &next
+	}
+	if len(days) == 0 {
+		return response, nil
+	}
+
+	dayKeys := make([]string, 0, len(days))
+	for _, day := range days {
+		dayKeys = append(dayKeys, day.Day)
+	}
+
+	// day key is computed in SQL so grouping matches the aggregation above
+	var meals []dayMeal
+	if err := repo.database.WithContext(c).
+		Model(&models.Meal{}).
+		Select("meals.*, TO_CHAR(date, 'YYYY-MM-DD') AS day").
+		Where("user_id = ? AND TO_CHAR(date, 'YYYY-MM-DD') IN ?", userId, dayKeys).
+		Order("date ASC").Order("time ASC").
+		Scan(&meals).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error listing meals by day", err)
+	}
+
+	plainMeals := make([]models.Meal, 0, len(meals))
+	for _, meal := range meals {
+		plainMeals = append(plainMeals, meal.Meal)
+	}
+	if err := loadMealTags(repo.database, c, plainMeals); err != nil {
+		return nil, err
+	}
+
+	mealsByDay := make(map[string][]models.Meal, len(days))
+	for i, meal := range meals {
+		mealsByDay[meal.Day] = append(mealsByDay[meal.Day], plainMeals[i])
+	}
+
+	for _, day := range days {
+		response.Days = append(response.Days, models.MealDay{
+			Day:              day.Day,
+			TotalMeals:       day.TotalMeals,
+			InDietMeals:      day.InDietMeals,
+			InDietPercentage: day.InDietPercentage,
+			Meals:            mealsByDay[day.Day],
+		})
+	}
+	return response, nil
+}
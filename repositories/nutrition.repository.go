@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/errors"
+
+	"github.com/google/uuid"
+)
+
+// GetMacroTotals sums the nutrition facts of the meals of userId per day or
+// per week (starting on Monday) between from and to included. Periods
+// without meals are listed with zero totals.
+func (repo *mealsRepository) GetMacroTotals(
+	c context.Context,
+	userId uuid.UUID,
+	period string,
+	from time.Time,
+	to time.Time,
+) ([]models.MacroTotals, error) {
+	start, end := macroPeriodRange(period, from, to)
+	periodStart := "TO_CHAR(date, 'YYYY-MM-DD')"
+	if period == models.MacroPeriodWeek {
+		periodStart = "TO_CHAR(date_trunc('week', date), 'YYYY-MM-DD')"
+	}
+
+	var rows []models.MacroTotals
+	if err := repo.database.WithContext(c).
+		Model(&models.Meal{}).
+		Select(periodStart+` AS period_start,
+			COUNT(*) AS meals,
+			COUNT(*) FILTER (WHERE calories IS NOT NULL OR protein IS NOT NULL OR carbs IS NOT NULL
+				OR fat IS NOT NULL OR fiber IS NOT NULL) AS tracked_meals,
+			COALESCE(SUM(calories), 0) AS calories,
+			COALESCE(SUM(protein), 0)::float8 AS protein,
+			COALESCE(SUM(carbs), 0)::float8 AS carbs,
+			COALESCE(SUM(fat), 0)::float8 AS fat,
+			COALESCE(SUM(fiber), 0)::float8 AS fiber`).
+		// include the whole "to" day
+		Where("user_id = ? AND date >= ? AND date < ?", userId, start, end.AddDate(0, 0, 1)).
+		Group("period_start").
+		Order("period_start ASC").
+		Scan(&rows).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error aggregating nutrition facts", err)
+	}
+
+	return fillMacroPeriods(period, start, end, rows), nil
+}
+
+// macroPeriodRange returns the first and last day of the totals, as UTC
+// midnights. Weeks start on Monday like date_trunc('week', ...).
+func macroPeriodRange(period string, from time.Time, to time.Time) (time.Time, time.Time) {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	if period == models.MacroPeriodWeek {
+		start = start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+	}
+	return start, end
+}
+
+// fillMacroPeriods lists every period starting between start and end, the
+// ones without a row get zero totals
+func fillMacroPeriods(period string, start time.Time, end time.Time, rows []models.MacroTotals) []models.MacroTotals {
+	days := 1
+	if period == models.MacroPeriodWeek {
+		days = 7
+	}
+	byPeriod := make(map[string]models.MacroTotals, len(rows))
+	for _, row := range rows {
+		byPeriod[row.PeriodStart] = row
+	}
+	totals := []models.MacroTotals{}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, days) {
+		key := day.Format(dayLayout)
+		row, ok := byPeriod[key]
+		if !ok {
+			row = models.MacroTotals{PeriodStart: key}
+		}
+		totals = append(totals, row)
+	}
+	return totals
+}
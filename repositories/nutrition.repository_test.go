@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"daily-diet-backend/models"
+)
+
+func parseDay(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(dayLayout, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestMacroPeriodRange(t *testing.T) {
+	day := func(value string) time.Time { return parseDay(t, value) }
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+
+	tests := []struct {
+		name      string
+		period    string
+		from      time.Time
+		to        time.Time
+		wantStart string
+		wantEnd   string
+	}{
+		{"days", models.MacroPeriodDay, day("2026-10-14"), day("2026-10-18"), "2026-10-14", "2026-10-18"},
+		{"time of day is dropped", models.MacroPeriodDay,
+			time.Date(2026, 10, 14, 23, 30, 0, 0, paris), time.Date(2026, 10, 18, 0, 30, 0, 0, paris),
+			"2026-10-14", "2026-10-18"},
+		{"week from a Wednesday", models.MacroPeriodWeek, day("2026-10-14"), day("2026-10-18"), "2026-10-12", "2026-10-18"},
+		{"week from a Sunday", models.MacroPeriodWeek, day("2026-10-18"), day("2026-10-19"), "2026-10-12", "2026-10-19"},
+		{"week from a Monday", models.MacroPeriodWeek, day("2026-10-19"), day("2026-10-26"), "2026-10-19", "2026-10-26"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end := macroPeriodRange(test.period, test.from, test.to)
+			if start.Format(dayLayout) != test.wantStart || end.Format(dayLayout) != test.wantEnd {
+				t.Errorf("macroPeriodRange() = %s, %s, want %s, %s",
+					start.Format(dayLayout), end.Format(dayLayout), test.wantStart, test.wantEnd)
+			}
+			if start.Location() != time.UTC || start.Hour() != 0 || end.Hour() != 0 {
+				t.Errorf("macroPeriodRange() = %s, %s, want UTC midnights", start, end)
+			}
+		})
+	}
+}
+
+func TestFillMacroPeriods(t *testing.T) {
+	day := func(value string) time.Time { return parseDay(t, value) }
+	periodStarts := func(totals []models.MacroTotals) []string {
+		starts := make([]string, 0, len(totals))
+		for _, total := range totals {
+			starts = append(starts, total.PeriodStart)
+		}
+		return starts
+	}
+
+	tests := []struct {
+		name       string
+		period     string
+		start      string
+		end        string
+		rows       []models.MacroTotals
+		wantStarts []string
+		// calories per period start, missing periods must be zero
+		wantCalories map[string]int64
+	}{
+		{
+			"days with gaps",
+			models.MacroPeriodDay, "2026-10-14", "2026-10-17",
+			[]models.MacroTotals{
+				{PeriodStart: "2026-10-15", Meals: 2, Calories: 1200},
+				{PeriodStart: "2026-10-17", Meals: 1, Calories: 500},
+			},
+			[]string{"2026-10-14", "2026-10-15", "2026-10-16", "2026-10-17"},
+			map[string]int64{"2026-10-15": 1200, "2026-10-17": 500},
+		},
+		{
+			"single day",
+			models.MacroPeriodDay, "2026-10-14", "2026-10-14", nil,
+			[]string{"2026-10-14"},
+			nil,
+		},
+		{
+			"weeks until a Sunday",
+			models.MacroPeriodWeek, "2026-10-12", "2026-11-01",
+			[]models.MacroTotals{{PeriodStart: "2026-10-19", Meals: 10, Calories: 14000}},
+			[]string{"2026-10-12", "2026-10-19", "2026-10-26"},
+			map[string]int64{"2026-10-19": 14000},
+		},
+		{
+			"weeks until a Monday",
+			models.MacroPeriodWeek, "2026-10-12", "2026-11-02", nil,
+			[]string{"2026-10-12", "2026-10-19", "2026-10-26", "2026-11-02"},
+			nil,
+		},
+		{
+			"end before start",
+			models.MacroPeriodDay, "2026-10-14", "2026-10-13", nil,
+			[]string{},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			totals := fillMacroPeriods(test.period, day(test.start), day(test.end), test.rows)
+			if starts := periodStarts(totals); !reflect.DeepEqual(starts, test.wantStarts) {
+				t.Fatalf("period starts = %v, want %v", starts, test.wantStarts)
+			}
+			for _, total := range totals {
+				if total.Calories != test.wantCalories[total.PeriodStart] {
+					t.Errorf("calories of %s = %d, want %d", total.PeriodStart, total.Calories, test.wantCalories[total.PeriodStart])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/crypt"
+	"daily-diet-backend/utils/errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateOIDCLoginState stores a pending authorization request, expired ones
+// are cleaned up on the way
+func (repo *userRepository) CreateOIDCLoginState(
+	c context.Context,
+	state string,
+	nonce string,
+	codeVerifier string,
+	deviceId *string,
+	ttl time.Duration,
+) error {
+	return repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expire_at < ?", time.Now()).
+			Delete(&models.OIDCLoginState{}).Error; err != nil {
+			return errors.NewError(errors.Internal, "error deleting expired login states", err)
+		}
+		loginState := &models.OIDCLoginState{
+			StateHash:    repo.hashToken(state),
+			Nonce:        nonce,
+			CodeVerifier: codeVerifier,
+			DeviceID:     deviceId,
+			ExpireAt:     time.Now().Add(ttl),
+		}
+		if err := tx.Create(loginState).Error; err != nil {
+			return errors.NewError(errors.Internal, "error creating login state", err)
+		}
+		return nil
+	})
+}
+
+// ConsumeOIDCLoginState deletes and returns the login state, a state can only
+// be used by one callback
+func (repo *userRepository) ConsumeOIDCLoginState(c context.Context, state string) (*models.OIDCLoginState, error) {
+	var loginStates []models.OIDCLoginState
+	result := repo.db.WithContext(c).
+		Clauses(clause.Returning{}).
+		Where("state_hash = ?", repo.hashToken(state)).
+		Delete(&loginStates)
+	if result.Error != nil {
+		return nil, errors.NewError(errors.Internal, "error consuming login state", result.Error)
+	}
+	if len(loginStates) == 0 || loginStates[0].ExpireAt.Before(time.Now()) {
+		return nil, errors.NewError(errors.Invalid, "invalid or expired login state", nil)
+	}
+	return &loginStates[0], nil
+}
+
+// FindOrCreateOIDCUser returns the user linked to the provider account. An
+// unknown account is linked to the user with the same email when both sides
+// verified it, or gets a new user.
+func (repo *userRepository) FindOrCreateOIDCUser(c context.Context, identity models.OIDCIdentityDTO) (*models.User, error) {
+	var user models.User
+	txErr := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var linked models.UserIdentity
+		err := tx.Preload("User").
+			Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).
+			First(&linked).Error
+		if err == nil {
+			if err := tx.Model(&linked).Updates(map[string]interface{}{
+				"email":         identity.Email,
+				"last_login_at": now,
+			}).Error; err != nil {
+				return errors.NewError(errors.Internal, "error updating identity", err)
+			}
+			user = linked.User
+			return nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return errors.NewError(errors.Internal, "error finding identity", err)
+		}
+
+		// an unverified email could belong to anyone, never link on it
+		if identity.Email == "" || !identity.EmailVerified {
+			return errors.NewError(errors.Forbidden, "the identity provider did not verify the email address", nil)
+		}
+
+		err = tx.Where("email = ?", identity.Email).First(&user).Error
+		switch {
+		case err == nil:
+			// whoever registered an unverified account may not own the email,
+			// linking it would let them keep a password on the account
+			if user.VerifiedAt == nil {
+				return errors.NewError(errors.Forbidden, "verify your email address before signing in with an identity provider", nil)
+			}
+		case err == gorm.ErrRecordNotFound:
+			if err := repo.createOIDCUser(tx, identity, &user); err != nil {
+				return err
+			}
+		default:
+			return errors.NewError(errors.Internal, "error finding user in database", err)
+		}
+
+		if err := tx.Create(&models.UserIdentity{
+			UserID:      user.ID,
+			Issuer:      identity.Issuer,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			LastLoginAt: &now,
+		}).Error; err != nil {
+			return errors.NewError(errors.Internal, "error linking identity", err)
+		}
+		return recordSecurityEvent(tx, c, &models.SecurityEvent{
+			UserID:  &user.ID,
+			Type:    models.SecurityEventIdentityLinked,
+			Details: identity.Issuer,
+		})
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+	if user.DisabledAt != nil {
+		return nil, errors.NewError(errors.Forbidden, "account disabled", nil)
+	}
+	return &user, nil
+}
+
+// createOIDCUser creates a verified user with a random password, a password
+// can be set later through the reset flow
+func (repo *userRepository) createOIDCUser(tx *gorm.DB, identity models.OIDCIdentityDTO, user *models.User) error {
+	randomPassword, err := crypt.RandomToken()
+	if err != nil {
+		return errors.NewError(errors.Internal, "error generating password", err)
+	}
+	hashedPassword, err := crypt.HashPassword(randomPassword)
+	if err != nil {
+		return errors.NewError(errors.Internal, "error hashing password", err)
+	}
+	name := identity.Name
+	if name == "" {
+		name = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+	now := time.Now()
+	*user = models.User{
+		Email:      identity.Email,
+		Name:       name,
+		Password:   hashedPassword,
+		VerifiedAt: &now,
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return errors.NewError(errors.Internal, "error creating user", err)
+	}
+	return nil
+}
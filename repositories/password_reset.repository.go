@@ -0,0 +1,146 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/crypt"
+	"daily-diet-backend/utils/errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CreatePasswordResetToken invalidates pending reset tokens of the user and
+// returns a new plain token, only its hash is stored
+func (repo *userRepository) CreatePasswordResetToken(
+	c context.Context,
+	userId uuid.UUID,
+	ttl time.Duration,
+) (string, error) {
+	plainToken, err := crypt.RandomToken()
+	if err != nil {
+		return "", errors.NewError(errors.Internal, "error generating reset token", err)
+	}
+
+	txErr := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", userId).
+			Update("used_at", time.Now()).Error; err != nil {
+			return errors.NewError(errors.Internal, "error invalidating reset tokens", err)
+		}
+		resetToken := &models.PasswordResetToken{
+			TokenHash: repo.hashToken(plainToken),
+			UserID:    userId,
+			ExpireAt:  time.Now().Add(ttl),
+		}
+		if err := tx.Create(resetToken).Error; err != nil {
+			return errors.NewError(errors.Internal, "error creating reset token", err)
+		}
+		return nil
+	})
+	if txErr != nil {
+		return "", txErr
+	}
+	return plainToken, nil
+}
+
+// ResetPassword consumes a reset token, sets the new password, revokes every
+// refresh token of the user and deletes their personal access tokens
+func (repo *userRepository) ResetPassword(c context.Context, token string, newPassword string) error {
+	hashedPassword, err := crypt.HashPassword(newPassword)
+	if err != nil {
+		return errors.NewError(errors.Internal, "error hashing password", err)
+	}
+
+	return repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var resetToken models.PasswordResetToken
+		if err := tx.Where("token_hash = ?", repo.hashToken(token)).
+			First(&resetToken).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.NewError(errors.Invalid, "invalid or expired reset token", nil)
+			}
+			return errors.NewError(errors.Internal, "error finding reset token", err)
+		}
+		if resetToken.ExpireAt.Before(time.Now()) {
+			return errors.NewError(errors.Invalid, "invalid or expired reset token", nil)
+		}
+
+		// single use, a concurrent reset with the same token loses here
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", resetToken.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return errors.NewError(errors.Internal, "error consuming reset token", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return errors.NewError(errors.Invalid, "invalid or expired reset token", nil)
+		}
+
+		if err := tx.Model(&models.User{}).
+			Where("id = ?", resetToken.UserID).
+			Update("password", hashedPassword).Error; err != nil {
+			return errors.NewError(errors.Internal, "error updating password", err)
+		}
+
+		if err := revokeUserRefreshTokens(tx, c, resetToken.UserID); err != nil {
+			return err
+		}
+		return deletePersonalAccessTokens(tx, c, resetToken.UserID)
+	})
+}
+
+// RecordPasswordResetRequest stores a forgot password request and returns
+// how many requests the email and the IP made since, including this one, and
+// when the email last asked before. Records older than since are deleted on
+// the way.
+func (repo *userRepository) RecordPasswordResetRequest(
+	c context.Context,
+	email string,
+	clientIP string,
+	since time.Time,
+) (int64, *time.Time, int64, error) {
+	emailHash := repo.hashToken(strings.ToLower(email))
+	var emailCount, ipCount int64
+	var previous *time.Time
+	txErr := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("created_at < ?", since).
+			Delete(&models.PasswordResetRequest{}).Error; err != nil {
+			return errors.NewError(errors.Internal, "error deleting old password reset requests", err)
+		}
+
+		var latest []models.PasswordResetRequest
+		if err := tx.Where("email_hash = ?", emailHash).
+			Order("created_at DESC").Limit(1).
+			Find(&latest).Error; err != nil {
+			return errors.NewError(errors.Internal, "error finding password reset requests", err)
+		}
+		if len(latest) > 0 {
+			previous = &latest[0].CreatedAt
+		}
+
+		if err := tx.Create(&models.PasswordResetRequest{
+			EmailHash: emailHash,
+			ClientIP:  clientIP,
+		}).Error; err != nil {
+			return errors.NewError(errors.Internal, "error recording password reset request", err)
+		}
+		if err := tx.Model(&models.PasswordResetRequest{}).
+			Where("email_hash = ? AND created_at >= ?", emailHash, since).
+			Count(&emailCount).Error; err != nil {
+			return errors.NewError(errors.Internal, "error counting password reset requests", err)
+		}
+		if err := tx.Model(&models.PasswordResetRequest{}).
+			Where("client_ip = ? AND created_at >= ?", clientIP, since).
+			Count(&ipCount).Error; err != nil {
+			return errors.NewError(errors.Internal, "error counting password reset requests", err)
+		}
+		return nil
+	})
+	if txErr != nil {
+		return 0, nil, 0, txErr
+	}
+	return emailCount, previous, ipCount, nil
+}
@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/crypt"
+	"daily-diet-backend/utils/errors"
+	"daily-diet-backend/utils/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// last_used_at is written at most this often per token
+const personalAccessTokenTouchInterval = time.Minute
+
+func (repo *userRepository) CreatePersonalAccessToken(
+	c context.Context,
+	userId uuid.UUID,
+	name string,
+	scopes string,
+	expiresAt time.Time,
+) (*models.PersonalAccessToken, error) {
+	random, err := crypt.RandomToken()
+	if err != nil {
+		return nil, errors.NewError(errors.Internal, "error generating token", err)
+	}
+	plain := models.PersonalAccessTokenPrefix + random
+
+	token := &models.PersonalAccessToken{
+		UserID:      userId,
+		Name:        name,
+		TokenHash:   repo.hashToken(plain),
+		Token:       plain,
+		TokenPrefix: plain[:len(models.PersonalAccessTokenPrefix)+8],
+		Scopes:      scopes,
+		ExpiresAt:   expiresAt,
+	}
+	if err := repo.db.WithContext(c).Create(token).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error creating token", err)
+	}
+	return token, nil
+}
+
+func (repo *userRepository) ListPersonalAccessTokens(c context.Context, userId uuid.UUID) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	if err := repo.db.WithContext(c).
+		Where("user_id = ?", userId).
+		Order("created_at DESC").
+		Find(&tokens).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error listing tokens", err)
+	}
+	return tokens, nil
+}
+
+func (repo *userRepository) RevokePersonalAccessToken(c context.Context, userId uuid.UUID, tokenId uuid.UUID) error {
+	result := repo.db.WithContext(c).
+		Where("id = ? AND user_id = ?", tokenId, userId).
+		Delete(&models.PersonalAccessToken{})
+	if result.Error != nil {
+		return errors.NewError(errors.Internal, "error revoking token", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.NewError(errors.NotFound, "token not found", nil)
+	}
+	return nil
+}
+
+// deletePersonalAccessTokens removes every personal access token of the
+// user, a changed password must not leave a long lived token working
+func deletePersonalAccessTokens(tx *gorm.DB, c context.Context, userId uuid.UUID) error {
+	if err := tx.WithContext(c).
+		Where("user_id = ?", userId).
+		Delete(&models.PersonalAccessToken{}).Error; err != nil {
+		return errors.NewError(errors.Internal, "error deleting personal access tokens", err)
+	}
+	return nil
+}
+
+// ValidatePersonalAccessToken returns the token with its user when it is
+// known and not expired, and records its use
+func (repo *userRepository) ValidatePersonalAccessToken(c context.Context, plain string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	result := repo.db.WithContext(c).
+		Preload("User").
+		Where("token_hash = ?", repo.hashToken(plain)).
+		First(&token)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, errors.NewError(errors.Unauthorized, "invalid token", result.Error)
+		}
+		return nil, errors.NewError(errors.Internal, "error finding token in database", result.Error)
+	}
+	if token.ExpiresAt.Before(time.Now()) {
+		return nil, errors.NewError(errors.Unauthorized, "token expired", nil)
+	}
+	if token.User.DisabledAt != nil {
+		return nil, errors.NewError(errors.Unauthorized, "account disabled", nil)
+	}
+	if token.User.DeletionScheduledAt != nil {
+		return nil, errors.NewError(errors.Unauthorized, "account scheduled for deletion", nil)
+	}
+
+	now := time.Now()
+	if err := repo.db.WithContext(c).
+		Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", token.ID, now.Add(-personalAccessTokenTouchInterval)).
+		Update("last_used_at", now).Error; err != nil {
+		logger.Log(logger.ERROR, "Error recording token use: "+err.Error())
+	}
+	return &token, nil
+}
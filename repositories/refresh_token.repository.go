@@ -0,0 +1,361 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/crypt"
+	"daily-diet-backend/utils/errors"
+	"daily-diet-backend/utils/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const refreshTokenTTL = time.Hour * 24 * 7 // 1 week
+
+// errTokenAlreadyRotated signals a rotation race lost inside a transaction,
+// it is turned into a TokenReused error once the transaction rolled back
+var errTokenAlreadyRotated = errors.NewError(errors.TokenReused, "refresh token already rotated", nil)
+
+// issueRefreshToken starts a new token family for the device, replacing the
+// previous session of that device and evicting the least recently used
+// sessions of the user when the maximum number of active devices is reached
+func (repo *userRepository) issueRefreshToken(
+	tx *gorm.DB,
+	c context.Context,
+	userId uuid.UUID,
+	deviceId *string,
+) (*models.RefreshToken, error) {
+	// lock the user row so concurrent logins do not exceed the device limit
+	var user models.User
+	if err := tx.WithContext(c).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		Where("id = ?", userId).
+		First(&user).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error locking user", err)
+	}
+
+	// logging in during the grace period cancels a scheduled deletion
+	cancelled := tx.WithContext(c).
+		Model(&models.User{}).
+		Where("id = ? AND deletion_scheduled_at IS NOT NULL", userId).
+		Update("deletion_scheduled_at", nil)
+	if cancelled.Error != nil {
+		return nil, errors.NewError(errors.Internal, "error cancelling account deletion", cancelled.Error)
+	}
+	if cancelled.RowsAffected > 0 {
+		logger.Log(logger.INFO, "Account deletion cancelled by login for user "+userId.String())
+	}
+
+	var active []models.RefreshToken
+	if err := activeRefreshTokens(tx.WithContext(c), userId).
+		Order("updated_at ASC").
+		Find(&active).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error listing refresh tokens", err)
+	}
+
+	// the device session is replaced, other sessions are evicted oldest first
+	evicted := []uuid.UUID{}
+	remaining := make([]models.RefreshToken, 0, len(active))
+	for _, token := range active {
+		if sameDevice(token.DeviceID, deviceId) {
+			evicted = append(evicted, token.FamilyID)
+			continue
+		}
+		remaining = append(remaining, token)
+	}
+	if repo.maxActiveSessions > 0 && len(remaining) >= repo.maxActiveSessions {
+		for _, token := range remaining[:len(remaining)-repo.maxActiveSessions+1] {
+			evicted = append(evicted, token.FamilyID)
+		}
+		logger.Log(logger.DEBUG, "Evicting oldest sessions of user "+userId.String())
+	}
+	if len(evicted) > 0 {
+		if err := revokeTokenFamilies(tx, c, evicted); err != nil {
+			return nil, err
+		}
+	}
+
+	return repo.createRefreshToken(tx, c, models.CreateRefreshTokenDTO{
+		UserID:   userId,
+		DeviceID: deviceId,
+	}, uuid.New(), nil)
+}
+
+func (repo *userRepository) CreateRefreshToken(c context.Context, data models.CreateRefreshTokenDTO) (*models.RefreshToken, error) {
+	var token *models.RefreshToken
+	txErr := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		token, err = repo.issueRefreshToken(tx, c, data.UserID, data.DeviceID)
+		return err
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+	return token, nil
+}
+
+func (repo *userRepository) createRefreshToken(
+	tx *gorm.DB,
+	c context.Context,
+	data models.CreateRefreshTokenDTO,
+	familyId uuid.UUID,
+	parentId *uuid.UUID,
+) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+
+	if data.DeviceID != nil {
+		token.DeviceID = data.DeviceID
+	}
+	token.UserID = data.UserID
+
+	token.ID = uuid.New()
+	token.Token = uuid.NewString()
+	token.TokenHash = repo.hashToken(token.Token)
+	token.FamilyID = familyId
+	token.ParentID = parentId
+	token.CreatedAt = time.Now()
+	token.UpdatedAt = time.Now()
+	token.ExpireAt = time.Now().Add(refreshTokenTTL)
+	token.Revoked = false
+	if err := tx.WithContext(c).Create(&token).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error creating refresh token", err)
+	}
+	return &token, nil
+}
+
+// rotateRefreshToken marks a token as rotated and creates its child in the
+// same family. Only one caller can rotate a given token, a lost race returns
+// errTokenAlreadyRotated.
+func (repo *userRepository) rotateRefreshToken(tx *gorm.DB, c context.Context, token *models.RefreshToken) (*models.RefreshToken, error) {
+	result := tx.WithContext(c).
+		Model(&models.RefreshToken{}).
+		Where("id = ? AND rotated_at IS NULL AND revoked = ?", token.ID, false).
+		Updates(map[string]interface{}{
+			"rotated_at": time.Now(),
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return nil, errors.NewError(errors.Internal, "error updating refresh token", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, errTokenAlreadyRotated
+	}
+
+	child, err := repo.createRefreshToken(tx, c, models.CreateRefreshTokenDTO{
+		UserID:   token.UserID,
+		DeviceID: token.DeviceID,
+	}, token.FamilyID, &token.ID)
+	if err != nil {
+		return nil, err
+	}
+	logger.Log(logger.DEBUG, "Refresh token rotated")
+	return child, nil
+}
+
+// handleTokenReuse revokes the whole family of a token presented after it was
+// rotated and records a security event. It commits on its own so the
+// revocation survives the error returned to the caller.
+func (repo *userRepository) handleTokenReuse(c context.Context, token *models.RefreshToken) error {
+	logger.Log(logger.WARNING, "Refresh token reuse detected for user "+token.UserID.String())
+	txErr := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := revokeTokenFamilies(tx, c, []uuid.UUID{token.FamilyID}); err != nil {
+			return err
+		}
+		return recordSecurityEvent(tx, c, &models.SecurityEvent{
+			UserID:   &token.UserID,
+			Type:     models.SecurityEventRefreshTokenReuse,
+			DeviceID: token.DeviceID,
+			Details:  "token family " + token.FamilyID.String() + " revoked",
+		})
+	})
+	if txErr != nil {
+		return txErr
+	}
+	return errors.NewError(errors.TokenReused, "refresh token reuse detected, session revoked", nil)
+}
+
+func (repo *userRepository) ValidateRefreshToken(c context.Context, refreshToken string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	result := repo.db.WithContext(c).Where("token_hash = ?", repo.hashToken(refreshToken)).First(&token)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, errors.NewError(errors.Unauthorized, "invalid refresh token", result.Error)
+		}
+		return nil, errors.NewError(errors.Internal, "error finding refresh token in database", result.Error)
+	}
+
+	// a rotated token must never be presented again
+	if token.RotatedAt != nil {
+		return nil, repo.handleTokenReuse(c, &token)
+	}
+	if token.Revoked {
+		return nil, errors.NewError(errors.Unauthorized, "token revoked", nil)
+	}
+	if token.ExpireAt.Before(time.Now()) {
+		return nil, errors.NewError(errors.Unauthorized, "token expired", nil)
+	}
+	// token is valid
+	return &token, nil
+}
+
+func (repo *userRepository) UpdateRefreshToken(c context.Context, refreshToken string, userId string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	result := repo.db.WithContext(c).Where("token_hash = ? AND user_id = ?", repo.hashToken(refreshToken), userId).First(&token)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, errors.NewError(errors.Unauthorized, "invalid refresh token", result.Error)
+		}
+		return nil, errors.NewError(errors.Internal, "error finding refresh token in database", result.Error)
+	}
+
+	var rotated *models.RefreshToken
+	txErr := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		rotated, err = repo.rotateRefreshToken(tx, c, &token)
+		return err
+	})
+	if txErr == errTokenAlreadyRotated {
+		// another request rotated the token first
+		return nil, repo.handleTokenReuse(c, &token)
+	}
+	if txErr != nil {
+		return nil, txErr
+	}
+	return rotated, nil
+}
+
+// RevokeRefreshToken ends the session the presented token belongs to
+func (repo *userRepository) RevokeRefreshToken(c context.Context, refreshToken string) error {
+	var token models.RefreshToken
+	result := repo.db.WithContext(c).Where("token_hash = ?", repo.hashToken(refreshToken)).First(&token)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return errors.NewError(errors.NotFound, "refresh token not found", result.Error)
+		}
+		return errors.NewError(errors.Internal, "error finding refresh token in database", result.Error)
+	}
+	return revokeTokenFamilies(repo.db, c, []uuid.UUID{token.FamilyID})
+}
+
+// GetSessionUser returns the user of an access token while the account is
+// enabled and, for tokens tied to a session, the session was not revoked
+func (repo *userRepository) GetSessionUser(c context.Context, userId uuid.UUID, sessionId *uuid.UUID) (*models.User, error) {
+	var user models.User
+	if err := repo.db.WithContext(c).Where("id = ?", userId).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewError(errors.Unauthorized, "user not found", err)
+		}
+		return nil, errors.NewError(errors.Internal, "error finding user in database", err)
+	}
+	if user.DisabledAt != nil {
+		return nil, errors.NewError(errors.Forbidden, "account disabled", nil)
+	}
+	if sessionId == nil {
+		return &user, nil
+	}
+
+	var active int64
+	if err := activeRefreshTokens(repo.db.WithContext(c), userId).
+		Model(&models.RefreshToken{}).
+		Where("family_id = ?", *sessionId).
+		Count(&active).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error checking session", err)
+	}
+	if active == 0 {
+		return nil, errors.NewError(errors.Unauthorized, "session ended", nil)
+	}
+	return &user, nil
+}
+
+// ListRefreshTokens returns the current token of every active session
+func (repo *userRepository) ListRefreshTokens(c context.Context, userId uuid.UUID) ([]models.RefreshToken, error) {
+	var tokens []models.RefreshToken
+	if err := activeRefreshTokens(repo.db.WithContext(c), userId).
+		Order("updated_at DESC").
+		Find(&tokens).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error listing refresh tokens", err)
+	}
+	return tokens, nil
+}
+
+// ListAllRefreshTokens returns every refresh token row of the user, including
+// rotated and revoked ones
+func (repo *userRepository) ListAllRefreshTokens(c context.Context, userId uuid.UUID) ([]models.RefreshToken, error) {
+	var tokens []models.RefreshToken
+	if err := repo.db.WithContext(c).
+		Where("user_id = ?", userId).
+		Order("created_at ASC").
+		Find(&tokens).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error listing refresh tokens", err)
+	}
+	return tokens, nil
+}
+
+func (repo *userRepository) RevokeTokenFamily(c context.Context, userId uuid.UUID, familyId uuid.UUID) error {
+	result := repo.db.WithContext(c).
+		Model(&models.RefreshToken{}).
+		Where("family_id = ? AND user_id = ? AND revoked = ?", familyId, userId, false).
+		Updates(map[string]interface{}{
+			"revoked":    true,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return errors.NewError(errors.Internal, "error revoking refresh token", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.NewError(errors.NotFound, "session not found", nil)
+	}
+	return nil
+}
+
+func revokeTokenFamilies(tx *gorm.DB, c context.Context, familyIds []uuid.UUID) error {
+	if err := tx.WithContext(c).
+		Model(&models.RefreshToken{}).
+		Where("family_id IN ? AND revoked = ?", familyIds, false).
+		Updates(map[string]interface{}{
+			"revoked":    true,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		return errors.NewError(errors.Internal, "error revoking refresh tokens", err)
+	}
+	return nil
+}
+
+// revokeUserRefreshTokens ends every session of a user
+func revokeUserRefreshTokens(tx *gorm.DB, c context.Context, userId uuid.UUID) error {
+	if err := tx.WithContext(c).
+		Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked = ?", userId, false).
+		Updates(map[string]interface{}{
+			"revoked":    true,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		return errors.NewError(errors.Internal, "error revoking refresh tokens", err)
+	}
+	return nil
+}
+
+// activeRefreshTokens scopes a query to the usable token of each live session
+func activeRefreshTokens(db *gorm.DB, userId uuid.UUID) *gorm.DB {
+	return db.Where(
+		"user_id = ? AND revoked = ? AND rotated_at IS NULL AND expire_at > ?",
+		userId, false, time.Now(),
+	)
+}
+
+// hashToken returns the value refresh tokens are stored and looked up by
+func (repo *userRepository) hashToken(token string) string {
+	return crypt.HashToken(repo.tokenHashKey, token)
+}
+
+func sameDevice(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,19 @@
+package repositories
+
+import (
+	"context"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/errors"
+
+	"gorm.io/gorm"
+)
+
+// recordSecurityEvent stores a security relevant event, inside tx when the
+// event is part of a larger operation
+func recordSecurityEvent(tx *gorm.DB, c context.Context, event *models.SecurityEvent) error {
+	if err := tx.WithContext(c).Create(event).Error; err != nil {
+		return errors.NewError(errors.Internal, "error recording security event", err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/errors"
+
+	"gorm.io/gorm"
+)
+
+type SigningKeyRepository interface {
+	ListActiveKeys(c context.Context) ([]models.SigningKey, error)
+	CreateKey(c context.Context, key *models.SigningKey) error
+	DeleteExpiredKeys(c context.Context) (int64, error)
+}
+
+type signingKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewSigningKeyRepository(db *gorm.DB) SigningKeyRepository {
+	return &signingKeyRepository{db: db}
+}
+
+// ListActiveKeys returns the keys still valid for verification, newest first
+func (repo *signingKeyRepository) ListActiveKeys(c context.Context) ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	if err := repo.db.WithContext(c).
+		Where("expires_at > ?", time.Now()).
+		Order("created_at DESC").
+		Find(&keys).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error listing signing keys", err)
+	}
+	return keys, nil
+}
+
+func (repo *signingKeyRepository) CreateKey(c context.Context, key *models.SigningKey) error {
+	if err := repo.db.WithContext(c).Create(key).Error; err != nil {
+		return errors.NewError(errors.Internal, "error saving signing key", err)
+	}
+	return nil
+}
+
+func (repo *signingKeyRepository) DeleteExpiredKeys(c context.Context) (int64, error) {
+	result := repo.db.WithContext(c).
+		Where("expires_at <= ?", time.Now()).
+		Delete(&models.SigningKey{})
+	if result.Error != nil {
+		return 0, errors.NewError(errors.Internal, "error deleting expired signing keys", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,142 @@
+package repositories
+
+import (
+	"context"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/errors"
+	"daily-diet-backend/utils/pagination"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ListTags returns the tags of the user used on at least one meal, most used
+// first, for autocompletion
+func (repo *mealsRepository) ListTags(
+	c context.Context,
+	userId uuid.UUID,
+	query models.ListTagsQuery,
+) ([]models.TagUsage, error) {
+	db := repo.database.WithContext(c).
+		Model(&models.Tag{}).
+		Select("tags.name, COUNT(meal_tags.meal_id) AS meal_count").
+		Joins("JOIN meal_tags ON meal_tags.tag_id = tags.id").
+		Where("tags.user_id = ?", userId)
+	if prefix := models.NormalizeTagName(query.Q); prefix != "" {
+		db = db.Where("tags.name LIKE ?", escapeLike(prefix)+"%")
+	}
+
+	var tags []models.TagUsage
+	if err := db.Group("tags.name").
+		Order("meal_count DESC").Order("tags.name ASC").
+		Limit(pagination.NormalizeLimit(query.Limit)).
+		Scan(&tags).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error listing tags", err)
+	}
+	return tags, nil
+}
+
+// setMealTags replaces the tags of a meal, creating the tags the user does
+// not have yet
+func setMealTags(tx *gorm.DB, c context.Context, meal *models.Meal, names []string) error {
+	tags := []models.Tag{}
+	for _, name := range normalizeTagNames(names) {
+		tags = append(tags, models.Tag{UserID: meal.UserID, Name: name})
+	}
+
+	if len(tags) > 0 {
+		// concurrent writes may create the same tag, the unique index settles it
+		if err := tx.WithContext(c).
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&tags).Error; err != nil {
+			return errors.NewError(errors.Internal, "error creating tags", err)
+		}
+		tagNames := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			tagNames = append(tagNames, tag.Name)
+		}
+		tags = nil
+		if err := tx.WithContext(c).
+			Where("user_id = ? AND name IN ?", meal.UserID, tagNames).
+			Order("name ASC").
+			Find(&tags).Error; err != nil {
+			return errors.NewError(errors.Internal, "error loading tags", err)
+		}
+	}
+
+	if err := tx.WithContext(c).Model(meal).Association("Tags").Replace(tags); err != nil {
+		return errors.NewError(errors.Internal, "error tagging meal", err)
+	}
+	meal.Tags = tags
+	return nil
+}
+
+// filterByTags keeps the meals having any, or with matchAll every, tag
+func filterByTags(db *gorm.DB, userId uuid.UUID, names []string, matchAll bool) *gorm.DB {
+	normalized := normalizeTagNames(names)
+	if len(normalized) == 0 {
+		return db
+	}
+
+	tagged := db.Session(&gorm.Session{NewDB: true}).
+		Table("meal_tags").
+		Select("meal_tags.meal_id").
+		Joins("JOIN tags ON tags.id = meal_tags.tag_id").
+		Where("tags.user_id = ? AND tags.name IN ?", userId, normalized)
+	if matchAll {
+		tagged = tagged.Group("meal_tags.meal_id").Having("COUNT(*) = ?", len(normalized))
+	}
+	return db.Where("id IN (?)", tagged)
+}
+
+// normalizeTagNames normalizes names and drops empty and repeated ones,
+// keeping the first occurrence order
+func normalizeTagNames(names []string) []string {
+	normalized := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = models.NormalizeTagName(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		normalized = append(normalized, name)
+	}
+	return normalized
+}
+
+// loadMealTags fills the tags of meals loaded without Preload
+func loadMealTags(db *gorm.DB, c context.Context, meals []models.Meal) error {
+	if len(meals) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(meals))
+	for _, meal := range meals {
+		ids = append(ids, meal.ID)
+	}
+
+	var rows []struct {
+		MealID uuid.UUID
+		models.Tag
+	}
+	if err := db.WithContext(c).
+		Table("meal_tags").
+		Select("meal_tags.meal_id, tags.*").
+		Joins("JOIN tags ON tags.id = meal_tags.tag_id").
+		Where("meal_tags.meal_id IN ?", ids).
+		Order("tags.name ASC").
+		Scan(&rows).Error; err != nil {
+		return errors.NewError(errors.Internal, "error loading tags", err)
+	}
+
+	byMeal := make(map[uuid.UUID][]models.Tag, len(meals))
+	for _, row := range rows {
+		byMeal[row.MealID] = append(byMeal[row.MealID], row.Tag)
+	}
+	for i := range meals {
+		meals[i].Tags = byMeal[meals[i].ID]
+	}
+	return nil
+}
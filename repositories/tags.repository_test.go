@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"daily-diet-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB builds SQL without a database server
+func dryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestNormalizeTagNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{"nil", nil, []string{}},
+		{"normalized", []string{" Vegan ", "Cheat  Day"}, []string{"vegan", "cheat day"}},
+		{"duplicates after normalizing", []string{"vegan", "VEGAN", " vegan"}, []string{"vegan"}},
+		{"blank names", []string{"", "  ", "keto"}, []string{"keto"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := normalizeTagNames(test.names); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("normalizeTagNames() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterByTags(t *testing.T) {
+	userId := uuid.New()
+	tests := []struct {
+		name     string
+		names    []string
+		matchAll bool
+		// fragments expected in the SQL, nil when no filter is added
+		wantSQL  []string
+		wantVars []interface{}
+	}{
+		{"no tags", nil, false, nil, nil},
+		{"blank tags only", []string{" ", ""}, true, nil, nil},
+		{
+			"any tag",
+			[]string{"Vegan", "keto", "vegan"},
+			false,
+			[]string{`id IN (SELECT meal_tags.meal_id FROM "meal_tags" JOIN tags ON tags.id = meal_tags.tag_id WHERE tags.user_id = $1 AND tags.name IN ($2,$3))`},
+			[]interface{}{userId, "vegan", "keto"},
+		},
+		{
+			"every tag",
+			[]string{"vegan", "keto"},
+			true,
+			[]string{"GROUP BY \"meal_tags\".\"meal_id\" HAVING COUNT(*) = $4"},
+			[]interface{}{userId, "vegan", "keto", 2},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := dryRunDB(t).Model(&models.Meal{})
+			var meals []models.Meal
+			statement := filterByTags(db, userId, test.names, test.matchAll).Find(&meals).Statement
+			sql := statement.SQL.String()
+
+			if test.wantSQL == nil {
+				if strings.Contains(sql, "meal_tags") {
+					t.Errorf("SQL filters on tags: %s", sql)
+				}
+				return
+			}
+			for _, fragment := range test.wantSQL {
+				if !strings.Contains(sql, fragment) {
+					t.Errorf("SQL %s\ndoes not contain %s", sql, fragment)
+				}
+			}
+			if !reflect.DeepEqual(statement.Vars, test.wantVars) {
+				t.Errorf("vars = %v, want %v", statement.Vars, test.wantVars)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/crypt"
+	"daily-diet-backend/utils/errors"
+	"daily-diet-backend/utils/totp"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const recoveryCodesCount = 10
+
+// SetPendingTOTPSecret stores a new encrypted secret waiting for EnableTOTP
+func (repo *userRepository) SetPendingTOTPSecret(c context.Context, userId uuid.UUID, secret string) error {
+	encrypted, err := crypt.Encrypt(repo.secretEncryptionKey, secret)
+	if err != nil {
+		return errors.NewError(errors.Internal, "error encrypting secret", err)
+	}
+	result := repo.db.WithContext(c).
+		Model(&models.User{}).
+		Where("id = ? AND totp_enabled_at IS NULL", userId).
+		Updates(map[string]interface{}{
+			"totp_secret":    encrypted,
+			"totp_last_step": 0,
+		})
+	if result.Error != nil {
+		return errors.NewError(errors.Internal, "error saving secret", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.NewError(errors.Invalid, "two factor authentication already enabled", nil)
+	}
+	return nil
+}
+
+// EnableTOTP confirms enrolment with a code of the pending secret and returns
+// freshly generated recovery codes, only their hashes are stored
+func (repo *userRepository) EnableTOTP(c context.Context, userId uuid.UUID, code string) ([]string, error) {
+	var recoveryCodes []string
+	txErr := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		user, err := lockUser(tx, c, userId)
+		if err != nil {
+			return err
+		}
+		if user.TOTPEnabledAt != nil {
+			return errors.NewError(errors.Invalid, "two factor authentication already enabled", nil)
+		}
+		if user.TOTPSecret == nil {
+			return errors.NewError(errors.Invalid, "two factor setup not started", nil)
+		}
+		if err := repo.consumeTOTPCode(tx, c, user, code); err != nil {
+			return err
+		}
+		if err := tx.Model(user).Update("totp_enabled_at", time.Now()).Error; err != nil {
+			return errors.NewError(errors.Internal, "error enabling two factor authentication", err)
+		}
+
+		recoveryCodes, err = repo.replaceRecoveryCodes(tx, c, userId)
+		return err
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+	return recoveryCodes, nil
+}
+
+// DisableTOTP requires the password and a current code (or recovery code)
+func (repo *userRepository) DisableTOTP(c context.Context, userId uuid.UUID, data models.TwoFactorDisableDTO) error {
+	return repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		user, err := lockUser(tx, c, userId)
+		if err != nil {
+			return err
+		}
+		if user.TOTPEnabledAt == nil {
+			return errors.NewError(errors.Invalid, "two factor authentication not enabled", nil)
+		}
+		if err := crypt.ComparePassword(user.Password, data.Password); err != nil {
+			return errors.NewError(errors.Unauthorized, "invalid password", err)
+		}
+		if err := repo.consumeSecondFactor(tx, c, user, data.Code); err != nil {
+			return err
+		}
+
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_secret":     nil,
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error; err != nil {
+			return errors.NewError(errors.Internal, "error disabling two factor authentication", err)
+		}
+		if err := tx.Where("user_id = ?", userId).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return errors.NewError(errors.Internal, "error deleting recovery codes", err)
+		}
+		return nil
+	})
+}
+
+// VerifySecondFactor checks a TOTP or recovery code during login, each code
+// is accepted only once. Invalid codes are throttled per user and a valid one
+// completes the login, clearing the failed attempts.
+func (repo *userRepository) VerifySecondFactor(c context.Context, userId uuid.UUID, code string) error {
+	if err := repo.checkTwoFactorThrottle(c, userId); err != nil {
+		return err
+	}
+
+	var user *models.User
+	txErr := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = lockUser(tx, c, userId)
+		if err != nil {
+			return err
+		}
+		if user.TOTPEnabledAt == nil {
+			return errors.NewError(errors.Invalid, "two factor authentication not enabled", nil)
+		}
+		return repo.consumeSecondFactor(tx, c, user, code)
+	})
+	if txErr != nil {
+		if customErr, ok := txErr.(*errors.CustomError); ok && customErr.Type == errors.Unauthorized {
+			repo.recordTwoFactorFailure(c, userId)
+		}
+		return txErr
+	}
+	repo.resetLoginFailures(c, user)
+	return nil
+}
+
+// consumeSecondFactor accepts a TOTP code, or else an unused recovery code
+func (repo *userRepository) consumeSecondFactor(tx *gorm.DB, c context.Context, user *models.User, code string) error {
+	totpErr := repo.consumeTOTPCode(tx, c, user, code)
+	if totpErr == nil {
+		return nil
+	}
+
+	result := tx.WithContext(c).
+		Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, repo.hashToken(normalizeRecoveryCode(code))).
+		Limit(1).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return errors.NewError(errors.Internal, "error checking recovery code", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return totpErr
+	}
+	return nil
+}
+
+// consumeTOTPCode validates a code and records its time step, replaying a
+// code of the same or an earlier step fails
+func (repo *userRepository) consumeTOTPCode(tx *gorm.DB, c context.Context, user *models.User, code string) error {
+	if user.TOTPSecret == nil {
+		return errors.NewError(errors.Unauthorized, "invalid code", nil)
+	}
+	secret, err := crypt.Decrypt(repo.secretEncryptionKey, *user.TOTPSecret)
+	if err != nil {
+		return errors.NewError(errors.Internal, "error decrypting secret", err)
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok || step <= user.TOTPLastStep {
+		return errors.NewError(errors.Unauthorized, "invalid code", nil)
+	}
+	if err := tx.WithContext(c).Model(user).Update("totp_last_step", step).Error; err != nil {
+		return errors.NewError(errors.Internal, "error saving code step", err)
+	}
+	return nil
+}
+
+func (repo *userRepository) replaceRecoveryCodes(tx *gorm.DB, c context.Context, userId uuid.UUID) ([]string, error) {
+	if err := tx.WithContext(c).Where("user_id = ?", userId).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error deleting recovery codes", err)
+	}
+	codes := make([]string, 0, recoveryCodesCount)
+	rows := make([]models.RecoveryCode, 0, recoveryCodesCount)
+	for i := 0; i < recoveryCodesCount; i++ {
+		random, err := crypt.RandomToken()
+		if err != nil {
+			return nil, errors.NewError(errors.Internal, "error generating recovery code", err)
+		}
+		code := random[:5] + "-" + random[5:10]
+		codes = append(codes, code)
+		rows = append(rows, models.RecoveryCode{
+			UserID:   userId,
+			CodeHash: repo.hashToken(normalizeRecoveryCode(code)),
+		})
+	}
+	if err := tx.WithContext(c).Create(&rows).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error saving recovery codes", err)
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(code)), "-", "")
+}
+
+// lockUser loads a user with a row lock for the rest of the transaction
+func lockUser(tx *gorm.DB, c context.Context, userId uuid.UUID) (*models.User, error) {
+	var user models.User
+	if err := tx.WithContext(c).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", userId).
+		First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewError(errors.NotFound, "user not found", err)
+		}
+		return nil, errors.NewError(errors.Internal, "error finding user in database", err)
+	}
+	return &user, nil
+}
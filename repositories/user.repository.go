@@ -17,19 +17,77 @@ import (
 type UserRepository interface {
 	CreateUser(c context.Context, data models.CreateUserDTO) (*models.User, error)
 	GetUserByEmail(c context.Context, email string) (*models.User, error)
-	Login(c context.Context, data models.LoginDTO) (*models.LoginResponse, error)
+	Authenticate(c context.Context, data models.LoginDTO) (*models.User, error)
 	CreateRefreshToken(c context.Context, data models.CreateRefreshTokenDTO) (*models.RefreshToken, error)
 	ValidateRefreshToken(c context.Context, refreshToken string) (*models.RefreshToken, error)
 	UpdateRefreshToken(c context.Context, refreshToken string, userId string) (*models.RefreshToken, error)
+	RevokeRefreshToken(c context.Context, refreshToken string) error
+	ListRefreshTokens(c context.Context, userId uuid.UUID) ([]models.RefreshToken, error)
+	RevokeTokenFamily(c context.Context, userId uuid.UUID, familyId uuid.UUID) error
+	GetSessionUser(c context.Context, userId uuid.UUID, sessionId *uuid.UUID) (*models.User, error)
 	GetUserByID(c context.Context, id string) (*models.User, error)
+	CreatePasswordResetToken(c context.Context, userId uuid.UUID, ttl time.Duration) (string, error)
+	ResetPassword(c context.Context, token string, newPassword string) error
+	CreateEmailVerificationToken(c context.Context, userId uuid.UUID, email string, ttl time.Duration) (string, error)
+	CreateEmailChangeToken(c context.Context, userId uuid.UUID, email string, sessionId *uuid.UUID, ttl time.Duration) (string, error)
+	CountEmailVerificationTokens(c context.Context, userId uuid.UUID, since time.Time) (int64, *time.Time, error)
+	VerifyEmail(c context.Context, token string) (*models.User, error)
+	UpdateUser(c context.Context, userId uuid.UUID, data models.UpdateUserDTO) (*models.User, error)
+	ChangePassword(c context.Context, userId uuid.UUID, data models.ChangePasswordDTO, keepSessionId *uuid.UUID) error
+	ScheduleDeletion(c context.Context, userId uuid.UUID, password string, gracePeriod time.Duration) (*time.Time, error)
+	PurgeDeletedUsers(c context.Context) (int64, error)
+	ListAllRefreshTokens(c context.Context, userId uuid.UUID) ([]models.RefreshToken, error)
+	SetPendingTOTPSecret(c context.Context, userId uuid.UUID, secret string) error
+	EnableTOTP(c context.Context, userId uuid.UUID, code string) ([]string, error)
+	DisableTOTP(c context.Context, userId uuid.UUID, data models.TwoFactorDisableDTO) error
+	VerifySecondFactor(c context.Context, userId uuid.UUID, code string) error
+	CreatePersonalAccessToken(c context.Context, userId uuid.UUID, name string, scopes string, expiresAt time.Time) (*models.PersonalAccessToken, error)
+	ListPersonalAccessTokens(c context.Context, userId uuid.UUID) ([]models.PersonalAccessToken, error)
+	RevokePersonalAccessToken(c context.Context, userId uuid.UUID, tokenId uuid.UUID) error
+	ValidatePersonalAccessToken(c context.Context, token string) (*models.PersonalAccessToken, error)
+	ListUsers(c context.Context, query models.AdminListUsersQuery) (*models.UsersPage, error)
+	SetUserRole(c context.Context, userId uuid.UUID, role string, actorId uuid.UUID) (*models.User, error)
+	SetUserDisabled(c context.Context, userId uuid.UUID, disabled bool, actorId uuid.UUID) (*models.User, error)
+	ForceLogout(c context.Context, userId uuid.UUID, actorId uuid.UUID) error
+	CreateOIDCLoginState(c context.Context, state string, nonce string, codeVerifier string, deviceId *string, ttl time.Duration) error
+	ConsumeOIDCLoginState(c context.Context, state string) (*models.OIDCLoginState, error)
+	FindOrCreateOIDCUser(c context.Context, identity models.OIDCIdentityDTO) (*models.User, error)
+	CreateMagicLinkToken(c context.Context, userId uuid.UUID, deviceId string, ttl time.Duration) (string, error)
+	ConsumeMagicLinkToken(c context.Context, token string, deviceId string) (*models.User, error)
+	RecordMagicLinkRequest(c context.Context, email string, clientIP string, since time.Time) (int64, *time.Time, int64, error)
+	RecordPasswordResetRequest(c context.Context, email string, clientIP string, since time.Time) (int64, *time.Time, int64, error)
+}
+
+type UserRepositoryOptions struct {
+	// Maximum active refresh tokens per user, 0 means unlimited
+	MaxActiveSessions int
+	// Key of the HMAC refresh tokens are stored with
+	TokenHashKey []byte
+	// Refuse logins until the user verified the email
+	RequireVerifiedLogin bool
+	// Key TOTP secrets are encrypted with
+	SecretEncryptionKey []byte
+	LoginThrottle       LoginThrottleOptions
 }
 
 type userRepository struct {
-	db *gorm.DB
+	db                   *gorm.DB
+	maxActiveSessions    int
+	tokenHashKey         []byte
+	requireVerifiedLogin bool
+	secretEncryptionKey  []byte
+	loginThrottle        LoginThrottleOptions
 }
 
-func NewUserRepository(db *gorm.DB) UserRepository {
-	return &userRepository{db: db}
+func NewUserRepository(db *gorm.DB, options UserRepositoryOptions) UserRepository {
+	return &userRepository{
+		db:                   db,
+		maxActiveSessions:    options.MaxActiveSessions,
+		tokenHashKey:         options.TokenHashKey,
+		requireVerifiedLogin: options.RequireVerifiedLogin,
+		secretEncryptionKey:  options.SecretEncryptionKey,
+		loginThrottle:        options.LoginThrottle,
+	}
 }
 
 func (repo *userRepository) CreateUser(c context.Context, data models.CreateUserDTO) (*models.User, error) {
@@ -77,141 +135,192 @@ func (repo *userRepository) GetUserByEmail(c context.Context, email string) (*mo
 	return user, nil
 }
 
-func (repo *userRepository) Login(c context.Context, data models.LoginDTO) (*models.LoginResponse, error) {
+// Authenticate checks the email and password of a login, the session itself
+// is created by CreateRefreshToken once every factor was checked. Unknown
+// emails and wrong passwords fail with the same error and are throttled per
+// account and per IP.
+func (repo *userRepository) Authenticate(c context.Context, data models.LoginDTO) (*models.User, error) {
+	if err := repo.checkLoginThrottle(c, data.Email, data.ClientIP); err != nil {
+		return nil, err
+	}
+
 	user, err := repo.GetUserByEmail(c, data.Email)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, errors.NewError(errors.NotFound, "user not found", err)
+		if err != gorm.ErrRecordNotFound {
+			return nil, err
 		}
-		return nil, err
+		compareDummyPassword(data.Password)
+		repo.recordLoginFailure(c, data.Email, data.ClientIP, nil)
+		return nil, errInvalidCredentials
 	}
 	if err := crypt.ComparePassword(user.Password, data.Password); err != nil {
-		return nil, errors.NewError(errors.Unauthorized, "invalid password", err)
+		repo.recordLoginFailure(c, data.Email, data.ClientIP, &user.ID)
+		return nil, errInvalidCredentials
 	}
 
-	var refreshToken models.RefreshToken
-	var finalToken *models.RefreshToken
+	if user.DisabledAt != nil {
+		return nil, errors.NewError(errors.Forbidden, "account disabled", nil)
+	}
+	if repo.requireVerifiedLogin && user.VerifiedAt == nil {
+		return nil, errors.NewError(errors.Forbidden, "email not verified", nil)
+	}
+	// with a second factor the login is only done once VerifySecondFactor passed
+	if user.TOTPEnabledAt == nil {
+		repo.resetLoginFailures(c, user)
+	}
+	return user, nil
+}
 
-	existingRefreshToken := repo.db.Where("user_id = ?", user.ID).First(&refreshToken)
-	if existingRefreshToken.Error != nil {
-		if existingRefreshToken.Error == gorm.ErrRecordNotFound {
-			// Create new refresh token
-			newRefreshToken := models.CreateRefreshTokenDTO{
-				UserID: user.ID,
+func (repo *userRepository) GetUserByID(c context.Context, id string) (*models.User, error) {
+	user := &models.User{}
+	result := repo.db.WithContext(c).Where("id = ?", id).First(user)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, result.Error
+		}
+		return nil, errors.NewError(errors.Internal, "error finding user in database", result.Error)
+	}
+	return user, nil
+}
+
+// UpdateUser applies a profile update. A new email needs the current password
+// and is only kept as pending, it replaces the current one once confirmed.
+// Asking for the current email again cancels a pending change.
+func (repo *userRepository) UpdateUser(c context.Context, userId uuid.UUID, data models.UpdateUserDTO) (*models.User, error) {
+	var user models.User
+	txErr := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", userId).First(&user).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.NewError(errors.NotFound, "user not found", err)
 			}
-			if data.DeviceID != nil {
-				newRefreshToken.DeviceID = data.DeviceID
+			return errors.NewError(errors.Internal, "error finding user in database", err)
+		}
+
+		patches := map[string]interface{}{}
+		if data.Name != nil {
+			patches["name"] = *data.Name
+		}
+		if data.Email != nil && *data.Email == user.Email && user.PendingEmail != nil {
+			patches["pending_email"] = nil
+		}
+		if data.Email != nil && *data.Email != user.Email {
+			if err := crypt.ComparePassword(user.Password, data.CurrentPassword); err != nil {
+				return errors.NewError(errors.Unauthorized, "invalid password", err)
 			}
-			finalToken, err = repo.CreateRefreshToken(c, newRefreshToken)
-			if err != nil {
-				return nil, errors.NewError(errors.Internal, "error creating refresh token", err)
+			if err := checkEmailAvailable(tx, *data.Email); err != nil {
+				return err
 			}
-		} else {
-			return nil, errors.NewError(errors.Internal, "error finding refresh token", existingRefreshToken.Error)
+			patches["pending_email"] = *data.Email
 		}
-	} else {
-		// Update existing token
-		finalToken, err = repo.UpdateRefreshToken(c, refreshToken.Token, user.ID.String())
-		if err != nil {
-			return nil, errors.NewError(errors.Internal, "error updating refresh token", err)
+		if len(patches) == 0 {
+			return nil
 		}
-	}
 
-	response := &models.LoginResponse{
-		User:         *user,
-		RefreshToken: finalToken.Token,
+		if err := tx.Model(&user).Updates(patches).Error; err != nil {
+			return errors.NewError(errors.Internal, "error updating user", err)
+		}
+		return tx.Where("id = ?", userId).First(&user).Error
+	})
+	if txErr != nil {
+		return nil, txErr
 	}
-
-	return response, nil
+	return &user, nil
 }
 
-func (repo *userRepository) CreateRefreshToken(c context.Context, data models.CreateRefreshTokenDTO) (*models.RefreshToken, error) {
-	var token models.RefreshToken
-
-	if data.DeviceID != nil {
-		token.DeviceID = data.DeviceID
+// checkEmailAvailable fails when another account already uses email
+func checkEmailAvailable(tx *gorm.DB, email string) error {
+	var count int64
+	if err := tx.Model(&models.User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+		return errors.NewError(errors.Internal, "database error", err)
 	}
-	token.UserID = data.UserID
-
-	token.Token = uuid.NewString()
-	token.CreatedAt = time.Now()
-	token.ExpireAt = time.Now().Add(time.Hour * 24 * 7) // 1 week
-	token.Revoked = false
-	if err := repo.db.Create(&token).Error; err != nil {
-		return nil, errors.NewError(errors.Internal, "error creating refresh token", err)
+	if count > 0 {
+		return errors.NewError(errors.Invalid, "email already in use", nil)
 	}
-	return &token, nil
+	return nil
 }
 
-func (repo *userRepository) ValidateRefreshToken(c context.Context, refreshToken string) (*models.RefreshToken, error) {
-	var token models.RefreshToken
-	result := repo.db.WithContext(c).Where("token = ?", refreshToken).First(&token)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			return nil, result.Error
+// ChangePassword checks the current password, stores the new one, revokes
+// every session except keepSessionId and deletes the personal access tokens
+func (repo *userRepository) ChangePassword(
+	c context.Context,
+	userId uuid.UUID,
+	data models.ChangePasswordDTO,
+	keepSessionId *uuid.UUID,
+) error {
+	return repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("id = ?", userId).First(&user).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.NewError(errors.NotFound, "user not found", err)
+			}
+			return errors.NewError(errors.Internal, "error finding user in database", err)
+		}
+		if err := crypt.ComparePassword(user.Password, data.CurrentPassword); err != nil {
+			return errors.NewError(errors.Unauthorized, "invalid password", err)
 		}
-		return nil, errors.NewError(errors.Internal, "error finding refresh token in database", result.Error)
-	}
 
-	if token.Revoked {
-		return nil, errors.NewError(errors.Unauthorized, "token revoked", nil)
-	}
-	if token.ExpireAt.Before(time.Now()) {
-		return nil, errors.NewError(errors.Unauthorized, "token expired", nil)
-	}
-	// token is valid
-	// update token and expire time
-	return &token, nil
-}
+		hashedPassword, err := crypt.HashPassword(data.NewPassword)
+		if err != nil {
+			return errors.NewError(errors.Internal, "error hashing password", err)
+		}
+		if err := tx.Model(&user).Update("password", hashedPassword).Error; err != nil {
+			return errors.NewError(errors.Internal, "error updating password", err)
+		}
 
-func (repo *userRepository) RevokeRefreshToken(c context.Context, refreshToken string) error {
-	var token models.RefreshToken
-	result := repo.db.WithContext(c).Where("token = ?", refreshToken).First(&token)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			return result.Error
+		revoke := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked = ?", userId, false)
+		if keepSessionId != nil {
+			revoke = revoke.Where("family_id <> ?", *keepSessionId)
 		}
-		return errors.NewError(errors.Internal, "error finding refresh token in database", result.Error)
-	}
-	token.Revoked = true
-	token.UpdatedAt = time.Now()
-	if err := repo.db.Save(&token).Error; err != nil {
-		return errors.NewError(errors.Internal, "error updating refresh token", err)
-	}
-	return nil
+		if err := revoke.Updates(map[string]interface{}{
+			"revoked":    true,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			return errors.NewError(errors.Internal, "error revoking refresh tokens", err)
+		}
+		return deletePersonalAccessTokens(tx, c, userId)
+	})
 }
 
-func (repo *userRepository) UpdateRefreshToken(c context.Context, refreshToken string, userId string) (*models.RefreshToken, error) {
-	var token models.RefreshToken
-	result := repo.db.WithContext(c).Where("token = ? AND user_id = ?", refreshToken, userId).First(&token)
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			return nil, result.Error
+// ScheduleDeletion checks the password, schedules the account for hard
+// deletion after the grace period and signs out every session
+func (repo *userRepository) ScheduleDeletion(
+	c context.Context,
+	userId uuid.UUID,
+	password string,
+	gracePeriod time.Duration,
+) (*time.Time, error) {
+	deleteAt := time.Now().Add(gracePeriod)
+	txErr := repo.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("id = ?", userId).First(&user).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.NewError(errors.NotFound, "user not found", err)
+			}
+			return errors.NewError(errors.Internal, "error finding user in database", err)
 		}
-		return nil, errors.NewError(errors.Internal, "error finding refresh token in database", result.Error)
-	}
-	patches := map[string]interface{}{
-		"expire_at":  time.Now().Add(time.Hour * 24 * 7),
-		"updated_at": time.Now(),
-		"token":      uuid.New().String(),
-	}
-	if err := repo.db.Model(&token).Updates(patches).Error; err != nil {
-		return nil, errors.NewError(errors.Internal, "error updating refresh token", err)
+		if err := crypt.ComparePassword(user.Password, password); err != nil {
+			return errors.NewError(errors.Unauthorized, "invalid password", err)
+		}
+		if err := tx.Model(&user).Update("deletion_scheduled_at", deleteAt).Error; err != nil {
+			return errors.NewError(errors.Internal, "error scheduling account deletion", err)
+		}
+		return revokeUserRefreshTokens(tx, c, userId)
+	})
+	if txErr != nil {
+		return nil, txErr
 	}
-	// return updated token
-	logger.Log(logger.DEBUG, "Refresh token updated")
-	logger.Log(logger.DEBUG, token.Token)
-	return &token, nil
+	return &deleteAt, nil
 }
 
-func (repo *userRepository) GetUserByID(c context.Context, id string) (*models.User, error) {
-	user := &models.User{}
-	result := repo.db.WithContext(c).Where("id = ?", id).First(user)
+// PurgeDeletedUsers hard deletes the accounts whose grace period is over,
+// related rows are removed by the ON DELETE CASCADE constraints
+func (repo *userRepository) PurgeDeletedUsers(c context.Context) (int64, error) {
+	result := repo.db.WithContext(c).
+		Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", time.Now()).
+		Delete(&models.User{})
 	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			return nil, result.Error
-		}
-		return nil, errors.NewError(errors.Internal, "error finding user in database", result.Error)
+		return 0, errors.NewError(errors.Internal, "error purging deleted users", result.Error)
 	}
-	return user, nil
+	return result.RowsAffected, nil
 }
@@ -3,13 +3,18 @@ package repositories
 import (
 	"context"
 	"daily-diet-backend/models"
+	"daily-diet-backend/utils/errors"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserStatsRepository interface {
-	GetStats(c context.Context, userId uuid.UUID) (*models.UserStats, error)
+	GetStats(c context.Context, viewerId uuid.UUID, ownerId uuid.UUID) (*models.UserStats, error)
+	RecomputeStats(c context.Context, userId uuid.UUID) (*models.UserStats, error)
+	RecomputeAllStats(c context.Context) (int, error)
+	GetMealTypeStats(c context.Context, viewerId uuid.UUID, ownerId uuid.UUID) ([]models.MealTypeStats, error)
 }
 
 type userStatsRepository struct {
@@ -20,13 +25,132 @@ func NewUserStatsRepository(client *gorm.DB) UserStatsRepository {
 	return &userStatsRepository{database: client}
 }
 
+// GetStats returns the stats of ownerId as seen by viewerId, the owner or a
+// coach with the stats:read scope
 func (repo *userStatsRepository) GetStats(
 	c context.Context,
-	userId uuid.UUID,
+	viewerId uuid.UUID,
+	ownerId uuid.UUID,
 ) (*models.UserStats, error) {
+	if err := checkReadAccess(repo.database, c, viewerId, ownerId, models.ScopeStatsRead); err != nil {
+		return nil, err
+	}
 	var stats models.UserStats
-	if err := repo.database.WithContext(c).Where("user_id = ?", userId).Find(&stats).Error; err != nil {
+	if err := repo.database.WithContext(c).Where("user_id = ?", ownerId).Find(&stats).Error; err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetMealTypeStats returns the in diet share per meal type of ownerId, every
+// type is listed even without meals
+func (repo *userStatsRepository) GetMealTypeStats(
+	c context.Context,
+	viewerId uuid.UUID,
+	ownerId uuid.UUID,
+) ([]models.MealTypeStats, error) {
+	if err := checkReadAccess(repo.database, c, viewerId, ownerId, models.ScopeStatsRead); err != nil {
 		return nil, err
 	}
+	var rows []models.MealTypeStats
+	if err := repo.database.WithContext(c).
+		Model(&models.Meal{}).
+		Select(`meal_type,
+			COUNT(*) AS total_meals,
+			COUNT(*) FILTER (WHERE `+models.EffectiveInDietSQL+`) AS in_diet_meals,
+			ROUND(100.0 * COUNT(*) FILTER (WHERE `+models.EffectiveInDietSQL+`) / COUNT(*), 2) AS in_diet_percentage`).
+		Where("user_id = ?", ownerId).
+		Group("meal_type").
+		Scan(&rows).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error aggregating meals by type", err)
+	}
+
+	byType := make(map[string]models.MealTypeStats, len(rows))
+	for _, row := range rows {
+		byType[row.MealType] = row
+	}
+	stats := make([]models.MealTypeStats, 0, len(models.MealTypes))
+	for _, mealType := range models.MealTypes {
+		row, ok := byType[mealType]
+		if !ok {
+			row = models.MealTypeStats{MealType: mealType}
+		}
+		stats = append(stats, row)
+	}
+	return stats, nil
+}
+
+func (repo *userStatsRepository) RecomputeStats(
+	c context.Context,
+	userId uuid.UUID,
+) (*models.UserStats, error) {
+	var stats *models.UserStats
+	txErr := repo.database.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		stats, err = RecomputeUserStats(tx, c, userId)
+		return err
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+	return stats, nil
+}
+
+// RecomputeAllStats rebuilds the stats of every user, one transaction per
+// user, and returns how many users were processed
+func (repo *userStatsRepository) RecomputeAllStats(c context.Context) (int, error) {
+	var userIds []uuid.UUID
+	if err := repo.database.WithContext(c).Model(&models.User{}).Pluck("id", &userIds).Error; err != nil {
+		return 0, errors.NewError(errors.Internal, "error listing users", err)
+	}
+	for i, userId := range userIds {
+		if _, err := repo.RecomputeStats(c, userId); err != nil {
+			return i, err
+		}
+	}
+	return len(userIds), nil
+}
+
+// mealHistory selects the meals of a user in the order their stats are
+// counted: by day, then time of day, then creation for meals logged at the
+// same time, so backdated meals land where they belong
+func mealHistory(db *gorm.DB, userId uuid.UUID) *gorm.DB {
+	return db.Model(&models.Meal{}).
+		Where("user_id = ?", userId).
+		Order("date::date ASC, time::time ASC, created_at ASC, id ASC")
+}
+
+// RecomputeUserStats derives the stats of a user from the full meal history,
+// ordered by Date and Time, and saves them. It must run inside the
+// transaction of the meal write that changed the history.
+func RecomputeUserStats(tx *gorm.DB, c context.Context, userId uuid.UUID) (*models.UserStats, error) {
+	// lock the user row so concurrent meal writes recompute one after the other
+	var user models.User
+	if err := tx.WithContext(c).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		Where("id = ?", userId).
+		First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewError(errors.NotFound, "user not found", err)
+		}
+		return nil, errors.NewError(errors.Internal, "error finding user", err)
+	}
+
+	var history []bool
+	if err := mealHistory(tx.WithContext(c), userId).Pluck(models.EffectiveInDietSQL, &history).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error loading meal history", err)
+	}
+
+	var stats models.UserStats
+	if err := tx.WithContext(c).Where("user_id = ?", userId).Limit(1).Find(&stats).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error finding user stats", err)
+	}
+	stats.UserID = userId
+	stats.ApplyHistory(history)
+
+	if err := tx.WithContext(c).Save(&stats).Error; err != nil {
+		return nil, errors.NewError(errors.Internal, "error saving user stats", err)
+	}
 	return &stats, nil
 }
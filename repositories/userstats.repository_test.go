@@ -0,0 +1,25 @@
+package repositories
+
+import (
+	"strings"
+	"testing"
+
+	"daily-diet-backend/models"
+
+	"github.com/google/uuid"
+)
+
+func TestMealHistoryQuery(t *testing.T) {
+	var history []bool
+	statement := mealHistory(dryRunDB(t), uuid.New()).Pluck(models.EffectiveInDietSQL, &history).Statement
+	sql := statement.SQL.String()
+
+	if !strings.Contains(sql, "SELECT "+models.EffectiveInDietSQL+" FROM") {
+		t.Errorf("history does not count the effective in diet value: %s", sql)
+	}
+	// backdated meals sort by their day, meals of one day by time of day,
+	// then the one logged first wins a tie
+	if !strings.HasSuffix(sql, "ORDER BY date::date ASC, time::time ASC, created_at ASC, id ASC") {
+		t.Errorf("unexpected history order: %s", sql)
+	}
+}
@@ -1,10 +1,17 @@
 package router
 
 import (
+	"context"
 	"daily-diet-backend/controllers"
+	"daily-diet-backend/models"
 	"daily-diet-backend/repositories"
 	"daily-diet-backend/services"
-	"os"
+	"daily-diet-backend/utils/config"
+	"daily-diet-backend/utils/mailer"
+	"daily-diet-backend/utils/oidc"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -15,18 +22,135 @@ import (
 func NewRouter(client *gorm.DB) *gin.Engine {
 	router := gin.Default()
 
+	// ClientIP feeds the login throttle and rate limits, X-Forwarded-For is
+	// only read from the proxies listed here, none by default
+	var trustedProxies []string
+	for _, proxy := range strings.Split(config.GetEnv("TRUSTED_PROXIES", ""), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+
 	// Swagger setup
 	url := ginSwagger.URL("http://localhost:8080/swagger/doc.json")
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, url))
 
 	v1 := router.Group("/v1")
-	jwt := []byte(os.Getenv("JWT_SECRET"))
-	usersRepo := repositories.NewUserRepository(client)
-	authService := services.NewAuthService(usersRepo, jwt)
 
-	controllers.RegisterAuthRoutes(v1, client)
+	signingKeyEncryptionKey := config.SigningKeyEncryptionKey()
+	refreshTokenHashKey := config.RefreshTokenHashKey()
+	totpEncryptionKey := config.TOTPEncryptionKey()
+	keyManager, err := services.NewKeyManager(repositories.NewSigningKeyRepository(client), services.KeyManagerOptions{
+		Algorithm:         config.GetEnv("JWT_ALGORITHM", models.SigningAlgorithmRS256),
+		RotationInterval:  config.GetEnvDuration("JWT_KEY_ROTATION_INTERVAL", 30*24*time.Hour),
+		VerificationGrace: config.GetEnvDuration("JWT_KEY_VERIFICATION_GRACE", 24*time.Hour),
+		RefreshInterval:   config.GetEnvDuration("JWT_KEY_REFRESH_INTERVAL", time.Minute),
+		EncryptionKey:     signingKeyEncryptionKey,
+	})
+	if err != nil {
+		log.Fatal("Failed to configure JWT signing: ", err)
+	}
+	if err := keyManager.Refresh(context.Background()); err != nil {
+		log.Fatal("Failed to load JWT signing keys: ", err)
+	}
+	go keyManager.Run(context.Background())
+
+	unverifiedPolicy := config.GetEnv("UNVERIFIED_USER_POLICY", models.UnverifiedPolicyAllow)
+	switch unverifiedPolicy {
+	case models.UnverifiedPolicyAllow, models.UnverifiedPolicyBlockMeals, models.UnverifiedPolicyBlockLogin:
+	default:
+		log.Fatalf("UNVERIFIED_USER_POLICY must be %s, %s or %s, got %q",
+			models.UnverifiedPolicyAllow, models.UnverifiedPolicyBlockMeals, models.UnverifiedPolicyBlockLogin, unverifiedPolicy)
+	}
+	usersRepo := repositories.NewUserRepository(client, repositories.UserRepositoryOptions{
+		MaxActiveSessions:    config.GetEnvInt("MAX_ACTIVE_SESSIONS", 5),
+		TokenHashKey:         refreshTokenHashKey,
+		RequireVerifiedLogin: unverifiedPolicy == models.UnverifiedPolicyBlockLogin,
+		SecretEncryptionKey:  totpEncryptionKey,
+		LoginThrottle: repositories.LoginThrottleOptions{
+			AccountMaxFailures:   config.GetEnvInt("LOGIN_MAX_FAILURES", 5),
+			IPMaxFailures:        config.GetEnvInt("LOGIN_IP_MAX_FAILURES", 50),
+			TwoFactorMaxFailures: config.GetEnvInt("LOGIN_2FA_MAX_FAILURES", 5),
+			BaseLockout:          config.GetEnvDuration("LOGIN_LOCKOUT", time.Minute),
+			MaxLockout:           config.GetEnvDuration("LOGIN_MAX_LOCKOUT", time.Hour),
+			FailureWindow:        config.GetEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		},
+	})
+	authService := services.NewAuthService(usersRepo, services.AuthServiceOptions{
+		Keys: keyManager,
+		Tokens: services.NewTokenIssuer(keyManager, services.TokenIssuerOptions{
+			TTL:      config.GetEnvDuration("ACCESS_TOKEN_TTL", time.Hour),
+			Issuer:   config.GetEnv("JWT_ISSUER", "daily-diet-backend"),
+			Audience: config.GetEnv("JWT_AUDIENCE", "daily-diet-api"),
+		}),
+		Mailer:                      mailer.NewMailerFromEnv(),
+		AppURL:                      config.GetEnv("APP_URL", "http://localhost:3000"),
+		APIURL:                      config.GetEnv("API_URL", "http://localhost:8080/v1"),
+		PasswordResetTTL:            config.GetEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		PasswordResetResendInterval: config.GetEnvDuration("PASSWORD_RESET_RESEND_INTERVAL", time.Minute),
+		PasswordResetPerHour:        config.GetEnvInt("PASSWORD_RESET_PER_HOUR", 5),
+		PasswordResetIPPerHour:      config.GetEnvInt("PASSWORD_RESET_IP_PER_HOUR", 20),
+		MagicLinkTTL:                config.GetEnvDuration("MAGIC_LINK_TTL", 15*time.Minute),
+		MagicLinkResendInterval:     config.GetEnvDuration("MAGIC_LINK_RESEND_INTERVAL", time.Minute),
+		MagicLinkPerHour:            config.GetEnvInt("MAGIC_LINK_PER_HOUR", 5),
+		MagicLinkIPPerHour:          config.GetEnvInt("MAGIC_LINK_IP_PER_HOUR", 20),
+		VerificationTTL:             config.GetEnvDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+		VerificationResendInterval:  config.GetEnvDuration("EMAIL_VERIFICATION_RESEND_INTERVAL", time.Minute),
+		VerificationResendPerHour:   config.GetEnvInt("EMAIL_VERIFICATION_RESEND_PER_HOUR", 5),
+		UnverifiedPolicy:            unverifiedPolicy,
+		TOTPIssuer:                  config.GetEnv("TOTP_ISSUER", "Daily Diet"),
+		OIDC:                        oidcProvider(),
+		OIDCStateTTL:                config.GetEnvDuration("OIDC_STATE_TTL", 10*time.Minute),
+	})
+
+	usersService := services.NewUsersService(
+		usersRepo,
+		repositories.NewMealsRepository(client),
+		repositories.NewUserStatsRepository(client),
+		authService,
+		config.GetEnvDuration("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour),
+	)
+
+	controllers.RegisterJWKSRoutes(router.Group("/.well-known"), keyManager)
+	controllers.RegisterAuthRoutes(v1, authService)
+	controllers.RegisterUsersRoutes(v1, usersService, authService)
 	controllers.RegisteredMealsRoutes(v1, client, authService)
+	controllers.RegisterMealCommentRoutes(v1, client, authService)
 	controllers.RegisterUserStatsRoutes(v1, client, authService)
+	controllers.RegisterCoachingRoutes(v1, services.NewCoachingService(
+		repositories.NewCoachingRepository(client),
+		repositories.NewMealsRepository(client),
+		repositories.NewUserStatsRepository(client),
+	), authService)
+	controllers.RegisterAdminRoutes(v1, services.NewAdminService(usersRepo, repositories.NewUserStatsRepository(client)), authService)
 
 	return router
 }
+
+// oidcProvider returns the identity provider configured by OIDC_ISSUER, or
+// nil when single sign-on is disabled
+func oidcProvider() *oidc.Provider {
+	issuer := config.GetEnv("OIDC_ISSUER", "")
+	if issuer == "" {
+		return nil
+	}
+	clientId := config.GetEnv("OIDC_CLIENT_ID", "")
+	redirectURL := config.GetEnv("OIDC_REDIRECT_URL", "")
+	if clientId == "" || redirectURL == "" {
+		log.Fatal("OIDC_ISSUER is set, OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required")
+	}
+	var scopes []string
+	if value := config.GetEnv("OIDC_SCOPES", ""); value != "" {
+		scopes = strings.Fields(value)
+	}
+	return oidc.NewProvider(oidc.Options{
+		Issuer:       issuer,
+		ClientID:     clientId,
+		ClientSecret: config.GetEnv("OIDC_CLIENT_SECRET", ""),
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+	})
+}
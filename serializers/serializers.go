@@ -0,0 +1,378 @@
+// Package serializers is the only way controllers write response bodies.
+// JSON refuses any payload that contains a GORM model (a type with a
+// TableName method), so database rows always go through one of the
+// converters below before reaching a client.
+package serializers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tabler is implemented by every GORM model of the models package
+type tabler interface {
+	TableName() string
+}
+
+var tablerType = reflect.TypeOf((*tabler)(nil)).Elem()
+
+// maxDepth bounds the payload walk, responses are shallow DTOs
+const maxDepth = 16
+
+// JSON writes payload as the response body, or a 500 when it embeds a model
+func JSON(ctx *gin.Context, status int, payload any) {
+	if modelType := findModel(reflect.ValueOf(payload), 0); modelType != nil {
+		logger.Log(logger.ERROR, "Refusing to serialize GORM model "+modelType.String())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal serialization error"})
+		return
+	}
+	ctx.JSON(status, payload)
+}
+
+// ZIP writes a zip archive holding one JSON document per entry, with the
+// same model check as JSON
+func ZIP(ctx *gin.Context, filename string, entries map[string]any) {
+	names := make([]string, 0, len(entries))
+	for name, entry := range entries {
+		if modelType := findModel(reflect.ValueOf(entry), 0); modelType != nil {
+			logger.Log(logger.ERROR, "Refusing to serialize GORM model "+modelType.String())
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal serialization error"})
+			return
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for _, name := range names {
+		file, err := archive.Create(name)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error building archive"})
+			return
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entries[name]); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error building archive"})
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error building archive"})
+		return
+	}
+
+	ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	ctx.Data(http.StatusOK, "application/zip", buffer.Bytes())
+}
+
+// findModel returns the type of the first GORM model found in value
+func findModel(value reflect.Value, depth int) reflect.Type {
+	if !value.IsValid() || depth > maxDepth {
+		return nil
+	}
+	valueType := value.Type()
+	if valueType.Implements(tablerType) || reflect.PointerTo(valueType).Implements(tablerType) {
+		return valueType
+	}
+
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return findModel(value.Elem(), depth+1)
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if !valueType.Field(i).IsExported() {
+				continue
+			}
+			if found := findModel(value.Field(i), depth+1); found != nil {
+				return found
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if found := findModel(value.Index(i), depth+1); found != nil {
+				return found
+			}
+		}
+	case reflect.Map:
+		iter := value.MapRange()
+		for iter.Next() {
+			if found := findModel(iter.Value(), depth+1); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+func UserProfile(user *models.User) models.UserProfileDTO {
+	return models.UserProfileDTO{
+		ID:           user.ID,
+		Name:         user.Name,
+		Email:        user.Email,
+		Role:         user.Role,
+		Verified:     user.VerifiedAt != nil,
+		PendingEmail: user.PendingEmail,
+		CreatedAt:    user.CreatedAt,
+	}
+}
+
+func Login(login *models.LoginResponse) models.LoginResponseDTO {
+	return models.LoginResponseDTO{
+		Token:        login.Token,
+		TokenType:    login.TokenType,
+		ExpiresAt:    login.ExpiresAt,
+		RefreshToken: login.RefreshToken,
+		SessionID:    login.SessionID,
+		User:         UserProfile(&login.User),
+	}
+}
+
+func PersonalAccessToken(token *models.PersonalAccessToken) models.PersonalAccessTokenDTO {
+	return models.PersonalAccessTokenDTO{
+		ID:          token.ID,
+		Name:        token.Name,
+		TokenPrefix: token.TokenPrefix,
+		Scopes:      token.ScopeList(),
+		ExpiresAt:   token.ExpiresAt,
+		LastUsedAt:  token.LastUsedAt,
+		CreatedAt:   token.CreatedAt,
+	}
+}
+
+func PersonalAccessTokens(tokens []models.PersonalAccessToken) []models.PersonalAccessTokenDTO {
+	serialized := make([]models.PersonalAccessTokenDTO, 0, len(tokens))
+	for i := range tokens {
+		serialized = append(serialized, PersonalAccessToken(&tokens[i]))
+	}
+	return serialized
+}
+
+func AdminUser(user *models.User) models.AdminUserDTO {
+	return models.AdminUserDTO{
+		ID:                  user.ID,
+		Name:                user.Name,
+		Email:               user.Email,
+		Role:                user.Role,
+		Verified:            user.VerifiedAt != nil,
+		TwoFactorEnabled:    user.TOTPEnabledAt != nil,
+		DisabledAt:          user.DisabledAt,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+		CreatedAt:           user.CreatedAt,
+	}
+}
+
+func AdminUsersPage(page *models.UsersPage) models.AdminUsersResponse {
+	users := make([]models.AdminUserDTO, 0, len(page.Users))
+	for i := range page.Users {
+		users = append(users, AdminUser(&page.Users[i]))
+	}
+	return models.AdminUsersResponse{
+		Users:      users,
+		NextCursor: page.NextCursor,
+	}
+}
+
+func UserSummary(user *models.User) models.UserSummaryDTO {
+	return models.UserSummaryDTO{
+		ID:    user.ID,
+		Name:  user.Name,
+		Email: user.Email,
+	}
+}
+
+func CoachClient(relation *models.CoachClient) models.CoachClientDTO {
+	return models.CoachClientDTO{
+		ID:          relation.ID,
+		Coach:       UserSummary(&relation.Coach),
+		Client:      UserSummary(&relation.Client),
+		Status:      relation.Status,
+		Scopes:      relation.ScopeList(),
+		CreatedAt:   relation.CreatedAt,
+		RespondedAt: relation.RespondedAt,
+		RevokedAt:   relation.RevokedAt,
+	}
+}
+
+func CoachClients(relations []models.CoachClient) []models.CoachClientDTO {
+	serialized := make([]models.CoachClientDTO, 0, len(relations))
+	for i := range relations {
+		serialized = append(serialized, CoachClient(&relations[i]))
+	}
+	return serialized
+}
+
+func Meal(meal *models.Meal) models.GetMealDTO {
+	return models.GetMealDTO{
+		ID:           meal.ID,
+		Name:         meal.Name,
+		Description:  meal.Description,
+		Date:         meal.Date,
+		Time:         meal.Time,
+		InDiet:       meal.EffectiveInDiet(),
+		OwnerInDiet:  meal.InDiet,
+		CoachVerdict: meal.ActiveCoachVerdict(),
+		MealType:     meal.MealType,
+		Tags:         TagNames(meal.Tags),
+		Calories:     meal.Calories,
+		Protein:      meal.Protein,
+		Carbs:        meal.Carbs,
+		Fat:          meal.Fat,
+		Fiber:        meal.Fiber,
+		CreatedAt:    meal.CreatedAt,
+		UpdatedAt:    meal.UpdatedAt,
+	}
+}
+
+func MacroTotals(period string, totals []models.MacroTotals) models.MacroTotalsResponse {
+	serialized := make([]models.MacroTotalsDTO, 0, len(totals))
+	for _, row := range totals {
+		serialized = append(serialized, models.MacroTotalsDTO{
+			PeriodStart:  row.PeriodStart,
+			Meals:        row.Meals,
+			TrackedMeals: row.TrackedMeals,
+			Calories:     row.Calories,
+			Protein:      row.Protein,
+			Carbs:        row.Carbs,
+			Fat:          row.Fat,
+			Fiber:        row.Fiber,
+		})
+	}
+	return models.MacroTotalsResponse{Period: period, Totals: serialized}
+}
+
+func TagNames(tags []models.Tag) []string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+func Tags(tags []models.TagUsage) []models.TagDTO {
+	serialized := make([]models.TagDTO, 0, len(tags))
+	for _, tag := range tags {
+		serialized = append(serialized, models.TagDTO{
+			Name:      tag.Name,
+			MealCount: tag.MealCount,
+		})
+	}
+	return serialized
+}
+
+func Meals(meals []models.Meal) []models.GetMealDTO {
+	serialized := make([]models.GetMealDTO, 0, len(meals))
+	for i := range meals {
+		serialized = append(serialized, Meal(&meals[i]))
+	}
+	return serialized
+}
+
+func MealsPage(page *models.MealsPage) models.ListMealsResponse {
+	meals := Meals(page.Meals)
+	for i := range meals {
+		unread := page.UnreadComments[meals[i].ID]
+		meals[i].UnreadComments = &unread
+	}
+	return models.ListMealsResponse{
+		Meals:      meals,
+		NextCursor: page.NextCursor,
+	}
+}
+
+func MealComment(comment *models.MealComment) models.MealCommentDTO {
+	return models.MealCommentDTO{
+		ID:             comment.ID,
+		MealID:         comment.MealID,
+		Author:         UserSummary(&comment.Author),
+		Body:           comment.Body,
+		Verdict:        comment.Verdict,
+		VerdictCleared: comment.VerdictCleared,
+		ReadAt:         comment.ReadAt,
+		CreatedAt:      comment.CreatedAt,
+	}
+}
+
+func MealComments(comments []models.MealComment) []models.MealCommentDTO {
+	serialized := make([]models.MealCommentDTO, 0, len(comments))
+	for i := range comments {
+		serialized = append(serialized, MealComment(&comments[i]))
+	}
+	return serialized
+}
+
+func Timeline(timeline *models.Timeline) models.TimelineResponse {
+	days := make([]models.MealDayDTO, 0, len(timeline.Days))
+	for _, day := range timeline.Days {
+		days = append(days, models.MealDayDTO{
+			Day:              day.Day,
+			TotalMeals:       day.TotalMeals,
+			InDietMeals:      day.InDietMeals,
+			InDietPercentage: day.InDietPercentage,
+			Meals:            Meals(day.Meals),
+		})
+	}
+	return models.TimelineResponse{
+		Days:       days,
+		NextCursor: timeline.NextCursor,
+	}
+}
+
+func MealTypeStats(stats []models.MealTypeStats) models.MealTypeStatsResponse {
+	serialized := make([]models.MealTypeStatsDTO, 0, len(stats))
+	for _, row := range stats {
+		serialized = append(serialized, models.MealTypeStatsDTO{
+			MealType:         row.MealType,
+			TotalMeals:       row.TotalMeals,
+			InDietMeals:      row.InDietMeals,
+			InDietPercentage: row.InDietPercentage,
+		})
+	}
+	return models.MealTypeStatsResponse{MealTypes: serialized}
+}
+
+func UserStats(stats *models.UserStats) models.UserStatsDTO {
+	return models.UserStatsDTO{
+		RegisteredMeals: stats.RegisteredMeals,
+		InDietMeals:     stats.InDietMeals,
+		CurrentStreak:   stats.CurrentStreak,
+		MaxStreak:       stats.MaxStreak,
+	}
+}
+
+func UserExport(export *models.UserExport) models.UserExportDTO {
+	sessions := make([]models.SessionExportDTO, 0, len(export.Sessions))
+	for _, token := range export.Sessions {
+		sessions = append(sessions, models.SessionExportDTO{
+			ID:        token.ID,
+			FamilyID:  token.FamilyID,
+			DeviceID:  token.DeviceID,
+			CreatedAt: token.CreatedAt,
+			UpdatedAt: token.UpdatedAt,
+			ExpireAt:  token.ExpireAt,
+			RotatedAt: token.RotatedAt,
+			Revoked:   token.Revoked,
+		})
+	}
+	return models.UserExportDTO{
+		ExportedAt: time.Now(),
+		Profile:    UserProfile(export.User),
+		Meals:      Meals(export.Meals),
+		Stats:      UserStats(export.Stats),
+		Sessions:   sessions,
+	}
+}
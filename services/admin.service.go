@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"daily-diet-backend/models"
+	"daily-diet-backend/repositories"
+	"daily-diet-backend/utils/errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AdminService interface {
+	ListUsers(c context.Context, query models.AdminListUsersQuery) (*models.UsersPage, error)
+	GetUser(c context.Context, userId uuid.UUID) (*models.User, error)
+	SetRole(c context.Context, userId uuid.UUID, role string, actorId uuid.UUID) (*models.User, error)
+	DisableUser(c context.Context, userId uuid.UUID, actorId uuid.UUID) (*models.User, error)
+	EnableUser(c context.Context, userId uuid.UUID, actorId uuid.UUID) (*models.User, error)
+	ForceLogout(c context.Context, userId uuid.UUID, actorId uuid.UUID) error
+	RecomputeStats(c context.Context, userId uuid.UUID) (*models.UserStats, error)
+}
+
+type adminService struct {
+	repo          repositories.UserRepository
+	userStatsRepo repositories.UserStatsRepository
+}
+
+func NewAdminService(repo repositories.UserRepository, userStatsRepo repositories.UserStatsRepository) AdminService {
+	return &adminService{repo: repo, userStatsRepo: userStatsRepo}
+}
+
+func (service *adminService) ListUsers(c context.Context, query models.AdminListUsersQuery) (*models.UsersPage, error) {
+	return service.repo.ListUsers(c, query)
+}
+
+func (service *adminService) GetUser(c context.Context, userId uuid.UUID) (*models.User, error) {
+	user, err := service.repo.GetUserByID(c, userId.String())
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewError(errors.NotFound, "user not found", err)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// SetRole changes the role of a user, admins cannot demote themselves so at
+// least one admin always remains
+func (service *adminService) SetRole(c context.Context, userId uuid.UUID, role string, actorId uuid.UUID) (*models.User, error) {
+	if userId == actorId && role != models.RoleAdmin {
+		return nil, errors.NewError(errors.Invalid, "you cannot remove your own admin role", nil)
+	}
+	return service.repo.SetUserRole(c, userId, role, actorId)
+}
+
+func (service *adminService) DisableUser(c context.Context, userId uuid.UUID, actorId uuid.UUID) (*models.User, error) {
+	if userId == actorId {
+		return nil, errors.NewError(errors.Invalid, "you cannot disable your own account", nil)
+	}
+	return service.repo.SetUserDisabled(c, userId, true, actorId)
+}
+
+func (service *adminService) EnableUser(c context.Context, userId uuid.UUID, actorId uuid.UUID) (*models.User, error) {
+	return service.repo.SetUserDisabled(c, userId, false, actorId)
+}
+
+func (service *adminService) ForceLogout(c context.Context, userId uuid.UUID, actorId uuid.UUID) error {
+	return service.repo.ForceLogout(c, userId, actorId)
+}
+
+func (service *adminService) RecomputeStats(c context.Context, userId uuid.UUID) (*models.UserStats, error) {
+	if _, err := service.GetUser(c, userId); err != nil {
+		return nil, err
+	}
+	return service.userStatsRepo.RecomputeStats(c, userId)
+}
@@ -4,9 +4,17 @@ import (
 	"context"
 	"daily-diet-backend/models"
 	"daily-diet-backend/repositories"
+	"daily-diet-backend/utils/errors"
+	"daily-diet-backend/utils/logger"
+	"daily-diet-backend/utils/mailer"
+	"daily-diet-backend/utils/oidc"
+	"daily-diet-backend/utils/totp"
+	"net/url"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type AuthService interface {
@@ -14,102 +22,573 @@ type AuthService interface {
 	GetUserByEmail(c context.Context, email string) (*models.User, error)
 	Login(c context.Context, data models.LoginDTO) (*models.LoginResponse, error)
 	ValidateToken(tokenString string) (*models.JwtTokenClaims, error)
-	ValidateRefreshToken(c context.Context, tokenString string) (*models.ValidateRefreshTokenResponse, error)
-	UpdateRefreshToken(c context.Context, refreshToken string, userId string) (*models.RefreshToken, error)
+	RefreshSession(c context.Context, refreshToken string) (*models.LoginResponse, error)
+	ValidatePersonalAccessToken(c context.Context, token string) (*models.PersonalAccessToken, error)
+	GetSessionUser(c context.Context, claims *models.JwtTokenClaims) (*models.User, error)
+	Logout(c context.Context, refreshToken string) error
+	ListSessions(c context.Context, userId uuid.UUID) ([]models.SessionDTO, error)
+	RevokeSession(c context.Context, userId uuid.UUID, sessionId uuid.UUID) error
+	ForgotPassword(c context.Context, data models.ForgotPasswordDTO) error
+	ResetPassword(c context.Context, data models.ResetPasswordDTO) error
+	VerifyEmail(c context.Context, token string) (*models.User, error)
+	ResendVerification(c context.Context, email string) error
+	UnverifiedPolicy() string
+	SendVerification(c context.Context, user *models.User) error
+	SendEmailChange(c context.Context, user *models.User, sessionId *uuid.UUID) error
+	LoginTwoFactor(c context.Context, data models.TwoFactorLoginDTO) (*models.LoginResponse, error)
+	SetupTwoFactor(c context.Context, userId uuid.UUID) (*models.TwoFactorSetupResponse, error)
+	EnableTwoFactor(c context.Context, userId uuid.UUID, code string) (*models.TwoFactorEnableResponse, error)
+	DisableTwoFactor(c context.Context, userId uuid.UUID, data models.TwoFactorDisableDTO) error
+	OIDCAuthorize(c context.Context, deviceId *string) (*models.OIDCAuthorizeResponse, error)
+	OIDCCallback(c context.Context, data models.OIDCCallbackDTO) (*models.LoginResponse, error)
+	RequestMagicLink(c context.Context, data models.MagicLinkRequestDTO) error
+	ExchangeMagicLink(c context.Context, data models.MagicLinkExchangeDTO) (*models.LoginResponse, error)
+}
+
+const (
+	twoFactorChallengeAudience = "daily-diet-2fa"
+	twoFactorChallengeTTL      = 5 * time.Minute
+)
+
+type AuthServiceOptions struct {
+	// Signs and verifies the two factor challenge tokens
+	Keys KeyManager
+	// Mints and verifies the access tokens
+	Tokens TokenIssuer
+	Mailer mailer.Mailer
+	// Base URL of the client app, links sent by email point to it
+	AppURL string
+	// Base URL of this API, e.g. http://localhost:8080/v1
+	APIURL           string
+	PasswordResetTTL time.Duration
+	// Minimum time between two reset emails for an email, and maximum
+	// requests per hour per email and per IP
+	PasswordResetResendInterval time.Duration
+	PasswordResetPerHour        int
+	PasswordResetIPPerHour      int
+	MagicLinkTTL                time.Duration
+	// Minimum time between two magic links for an email, and maximum
+	// requests per hour per email and per IP
+	MagicLinkResendInterval time.Duration
+	MagicLinkPerHour        int
+	MagicLinkIPPerHour      int
+	VerificationTTL         time.Duration
+	// Minimum time between two verification emails and maximum per hour
+	VerificationResendInterval time.Duration
+	VerificationResendPerHour  int
+	// One of the models.UnverifiedPolicy* values
+	UnverifiedPolicy string
+	// Issuer shown by authenticator apps
+	TOTPIssuer string
+	// Identity provider for single sign-on, nil when not configured
+	OIDC *oidc.Provider
+	// How long the user has to complete the sign-in at the provider
+	OIDCStateTTL time.Duration
 }
 
 type authService struct {
-	Repo      repositories.UserRepository
-	JwtSecret []byte
+	Repo    repositories.UserRepository
+	Keys    KeyManager
+	Tokens  TokenIssuer
+	Mailer  mailer.Mailer
+	Options AuthServiceOptions
 }
 
-func NewAuthService(repo repositories.UserRepository, jwtSecret []byte) AuthService {
-	return &authService{Repo: repo, JwtSecret: jwtSecret}
+func NewAuthService(repo repositories.UserRepository, options AuthServiceOptions) AuthService {
+	return &authService{
+		Repo:    repo,
+		Keys:    options.Keys,
+		Tokens:  options.Tokens,
+		Mailer:  options.Mailer,
+		Options: options,
+	}
 }
 
 func (service *authService) CreateUser(c context.Context, data models.CreateUserDTO) (*models.User, error) {
-	return service.Repo.CreateUser(c, data)
+	user, err := service.Repo.CreateUser(c, data)
+	if err != nil {
+		return nil, err
+	}
+	// the account exists even if the email could not be sent, it can be resent
+	if err := service.SendVerification(c, user); err != nil {
+		logger.Log(logger.ERROR, "Error sending verification email: "+err.Error())
+	}
+	return user, nil
 }
 
 func (service *authService) GetUserByEmail(c context.Context, email string) (*models.User, error) {
 	return service.Repo.GetUserByEmail(c, email)
 }
 
+// Login checks the password. Users with two factor authentication get a
+// challenge token instead of a session, see LoginTwoFactor.
 func (service *authService) Login(c context.Context, data models.LoginDTO) (*models.LoginResponse, error) {
-	userLogin, err := service.Repo.Login(c, data)
+	user, err := service.Repo.Authenticate(c, data)
+	if err != nil {
+		return nil, err
+	}
+	return service.completeLogin(c, user, data.DeviceID)
+}
+
+// completeLogin starts the session of an authenticated user, or returns a
+// challenge token when a second factor is still needed
+func (service *authService) completeLogin(c context.Context, user *models.User, deviceId *string) (*models.LoginResponse, error) {
+	if user.TOTPEnabledAt != nil {
+		challenge, err := service.signChallenge(user.ID, deviceId)
+		if err != nil {
+			return nil, err
+		}
+		return &models.LoginResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+		}, nil
+	}
+	return service.issueSession(c, user, deviceId)
+}
+
+// OIDCAuthorize starts a sign-in at the identity provider, the state, nonce
+// and PKCE verifier are kept until the callback
+func (service *authService) OIDCAuthorize(c context.Context, deviceId *string) (*models.OIDCAuthorizeResponse, error) {
+	if service.Options.OIDC == nil {
+		return nil, errors.NewError(errors.NotFound, "single sign-on is not configured", nil)
+	}
+	var secrets [3]string
+	for i := range secrets {
+		value, err := oidc.RandomString()
+		if err != nil {
+			return nil, errors.NewError(errors.Internal, "error generating login state", err)
+		}
+		secrets[i] = value
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	authorizationURL, err := service.Options.OIDC.AuthCodeURL(c, state, nonce, verifier)
+	if err != nil {
+		return nil, errors.NewError(errors.Internal, "error contacting the identity provider", err)
+	}
+	if err := service.Repo.CreateOIDCLoginState(c, state, nonce, verifier, deviceId, service.Options.OIDCStateTTL); err != nil {
+		return nil, err
+	}
+	return &models.OIDCAuthorizeResponse{
+		AuthorizationURL: authorizationURL,
+		ExpiresAt:        time.Now().Add(service.Options.OIDCStateTTL),
+	}, nil
+}
+
+// OIDCCallback redeems the code the provider sent back and signs in the
+// linked user, with the same response as Login
+func (service *authService) OIDCCallback(c context.Context, data models.OIDCCallbackDTO) (*models.LoginResponse, error) {
+	if service.Options.OIDC == nil {
+		return nil, errors.NewError(errors.NotFound, "single sign-on is not configured", nil)
+	}
+	loginState, err := service.Repo.ConsumeOIDCLoginState(c, data.State)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := service.Options.OIDC.Exchange(c, data.Code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		return nil, errors.NewError(errors.Unauthorized, "sign-in with the identity provider failed", err)
+	}
+	user, err := service.Repo.FindOrCreateOIDCUser(c, models.OIDCIdentityDTO{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return service.completeLogin(c, user, loginState.DeviceID)
+}
+
+// LoginTwoFactor exchanges a challenge token and a TOTP or recovery code for
+// a session
+func (service *authService) LoginTwoFactor(c context.Context, data models.TwoFactorLoginDTO) (*models.LoginResponse, error) {
+	challenge := &models.TwoFactorChallengeClaims{}
+	_, err := jwt.ParseWithClaims(data.ChallengeToken, challenge, service.Keys.Keyfunc,
+		jwt.WithValidMethods(service.Keys.Methods()),
+		jwt.WithAudience(twoFactorChallengeAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, errors.NewError(errors.Unauthorized, "invalid or expired challenge token", err)
+	}
+
+	if err := service.Repo.VerifySecondFactor(c, challenge.UserID, data.Code); err != nil {
+		return nil, err
+	}
+	user, err := service.Repo.GetUserByID(c, challenge.UserID.String())
+	if err != nil {
+		return nil, err
+	}
+	return service.issueSession(c, user, challenge.DeviceID)
+}
+
+// issueSession creates the refresh token of a new session and its access token
+func (service *authService) issueSession(c context.Context, user *models.User, deviceId *string) (*models.LoginResponse, error) {
+	refreshToken, err := service.Repo.CreateRefreshToken(c, models.CreateRefreshTokenDTO{
+		UserID:   user.ID,
+		DeviceID: deviceId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return service.loginResponse(user, refreshToken)
+}
+
+// RefreshSession rotates a refresh token and issues a new access token for
+// its session, with the same response as Login
+func (service *authService) RefreshSession(c context.Context, refreshToken string) (*models.LoginResponse, error) {
+	token, err := service.Repo.ValidateRefreshToken(c, refreshToken)
 	if err != nil {
 		return nil, err
 	}
-	/*
-		Generate JWT token -> 1 hour expiration
-	*/
-	claims := &models.JwtTokenClaims{
-		Email: data.Email,
-		/* store userId, better for fetches latter */
-		ID: userLogin.User.ID,
+	rotated, err := service.Repo.UpdateRefreshToken(c, refreshToken, token.UserID.String())
+	if err != nil {
+		return nil, err
+	}
+	user, err := service.Repo.GetUserByID(c, rotated.UserID.String())
+	if err != nil {
+		return nil, err
+	}
+	return service.loginResponse(user, rotated)
+}
+
+func (service *authService) loginResponse(user *models.User, refreshToken *models.RefreshToken) (*models.LoginResponse, error) {
+	if user.DisabledAt != nil {
+		return nil, errors.NewError(errors.Forbidden, "account disabled", nil)
+	}
+	accessToken, expiresAt, err := service.Tokens.IssueAccessToken(user, refreshToken.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.LoginResponse{
+		Token:        accessToken,
+		TokenType:    "Bearer",
+		ExpiresAt:    expiresAt,
+		RefreshToken: refreshToken.Token,
+		SessionID:    refreshToken.FamilyID,
+		User:         *user,
+	}, nil
+}
+
+func (service *authService) signChallenge(userId uuid.UUID, deviceId *string) (string, error) {
+	claims := &models.TwoFactorChallengeClaims{
+		UserID:   userId,
+		DeviceID: deviceId,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+			Audience:  jwt.ClaimStrings{twoFactorChallengeAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(twoFactorChallengeTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "daily-diet-backend",
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString(service.JwtSecret)
+	return service.Keys.Sign(claims)
+}
+
+// SetupTwoFactor generates a new secret, it is only active once confirmed by
+// EnableTwoFactor
+func (service *authService) SetupTwoFactor(c context.Context, userId uuid.UUID) (*models.TwoFactorSetupResponse, error) {
+	user, err := service.Repo.GetUserByID(c, userId.String())
 	if err != nil {
 		return nil, err
 	}
-	return &models.LoginResponse{
-		Token:        signedToken,
-		RefreshToken: userLogin.RefreshToken,
-		User:         userLogin.User,
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, errors.NewError(errors.Internal, "error generating secret", err)
+	}
+	if err := service.Repo.SetPendingTOTPSecret(c, userId, secret); err != nil {
+		return nil, err
+	}
+	return &models.TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(service.Options.TOTPIssuer, user.Email, secret),
 	}, nil
 }
 
+func (service *authService) EnableTwoFactor(c context.Context, userId uuid.UUID, code string) (*models.TwoFactorEnableResponse, error) {
+	codes, err := service.Repo.EnableTOTP(c, userId, code)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TwoFactorEnableResponse{RecoveryCodes: codes}, nil
+}
+
+func (service *authService) DisableTwoFactor(c context.Context, userId uuid.UUID, data models.TwoFactorDisableDTO) error {
+	return service.Repo.DisableTOTP(c, userId, data)
+}
+
 func (service *authService) ValidateToken(tokenString string) (*models.JwtTokenClaims, error) {
-	claims := &models.JwtTokenClaims{} // declare new empty claims
-	// parse jwt with base JwtTokenClaims structure
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return service.JwtSecret, nil
-	})
+	return service.Tokens.ParseAccessToken(tokenString)
+}
+
+// GetSessionUser returns the current state of the user behind valid access token
+// claims, failing once the session was revoked or the account disabled
+func (service *authService) GetSessionUser(c context.Context, claims *models.JwtTokenClaims) (*models.User, error) {
+	return service.Repo.GetSessionUser(c, claims.ID, claims.SessionID)
+}
+
+func (service *authService) ValidatePersonalAccessToken(c context.Context, token string) (*models.PersonalAccessToken, error) {
+	return service.Repo.ValidatePersonalAccessToken(c, token)
+}
+
+func (service *authService) Logout(c context.Context, refreshToken string) error {
+	return service.Repo.RevokeRefreshToken(c, refreshToken)
+}
 
+func (service *authService) ListSessions(c context.Context, userId uuid.UUID) ([]models.SessionDTO, error) {
+	tokens, err := service.Repo.ListRefreshTokens(c, userId)
 	if err != nil {
 		return nil, err
 	}
+	sessions := make([]models.SessionDTO, 0, len(tokens))
+	for _, token := range tokens {
+		sessions = append(sessions, models.SessionDTO{
+			ID:        token.FamilyID,
+			DeviceID:  token.DeviceID,
+			CreatedAt: token.CreatedAt,
+			LastUsed:  token.UpdatedAt,
+			ExpireAt:  token.ExpireAt,
+		})
+	}
+	return sessions, nil
+}
 
-	claims, ok := token.Claims.(*models.JwtTokenClaims)
-	if !ok || !token.Valid {
-		return nil, err
+func (service *authService) RevokeSession(c context.Context, userId uuid.UUID, sessionId uuid.UUID) error {
+	return service.Repo.RevokeTokenFamily(c, userId, sessionId)
+}
+
+// ForgotPassword emails a reset link in the background, so the response time
+// and outcome are the same whether the email is registered or not. Only the
+// per IP limit is reported, requests over the per email limits are skipped.
+func (service *authService) ForgotPassword(c context.Context, data models.ForgotPasswordDTO) error {
+	emailCount, previous, ipCount, err := service.Repo.RecordPasswordResetRequest(c, data.Email, data.ClientIP, time.Now().Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+	if service.Options.PasswordResetIPPerHour > 0 && ipCount > int64(service.Options.PasswordResetIPPerHour) {
+		return errors.NewError(errors.RateLimited, "too many password resets requested, try again later", nil)
+	}
+	if previous != nil && time.Since(*previous) < service.Options.PasswordResetResendInterval {
+		logger.Log(logger.DEBUG, "Password reset requested again too soon, skipped")
+		return nil
 	}
-	return claims, nil
+	if service.Options.PasswordResetPerHour > 0 && emailCount > int64(service.Options.PasswordResetPerHour) {
+		logger.Log(logger.DEBUG, "Too many password resets for one email, skipped")
+		return nil
+	}
+
+	service.background("password reset email", func(c context.Context) error {
+		return service.sendPasswordReset(c, data.Email)
+	})
+	return nil
 }
 
-func (service *authService) ValidateRefreshToken(c context.Context, tokenString string) (*models.ValidateRefreshTokenResponse, error) {
-	refresh_token, err := service.Repo.ValidateRefreshToken(c, tokenString)
+func (service *authService) sendPasswordReset(c context.Context, email string) error {
+	user, err := service.Repo.GetUserByEmail(c, email)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logger.Log(logger.DEBUG, "Password reset requested for unknown email")
+			return nil
+		}
+		return err
+	}
 
+	token, err := service.Repo.CreatePasswordResetToken(c, user.ID, service.Options.PasswordResetTTL)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if refresh_token != nil {
-		// get user by refresh_token userId
-		relatedUser, err := service.Repo.GetUserByID(c, refresh_token.UserID.String())
-		if err != nil {
-			return nil, err
+
+	link := service.Options.AppURL + "/reset-password?token=" + url.QueryEscape(token)
+	return service.Mailer.Send(c, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Daily Diet password",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Use the link below to choose a new password. It expires in " +
+			service.Options.PasswordResetTTL.String() + " and can only be used once.\n\n" +
+			link + "\n\n" +
+			"If you did not ask for a reset you can ignore this email.",
+	})
+}
+
+// backgroundJobTimeout bounds the emails sent after the response
+const backgroundJobTimeout = 30 * time.Second
+
+// background runs job after the request returned, errors are only logged
+func (service *authService) background(name string, job func(c context.Context) error) {
+	go func() {
+		c, cancel := context.WithTimeout(context.Background(), backgroundJobTimeout)
+		defer cancel()
+		if err := job(c); err != nil {
+			logger.Log(logger.ERROR, "Error sending "+name+": "+err.Error())
 		}
-		validatedResponse := &models.ValidateRefreshTokenResponse{
-			RefreshToken: &refresh_token.Token,
-			UserEmail:    &relatedUser.Email,
-			UserID:       &refresh_token.UserID,
+	}()
+}
+
+// RequestMagicLink emails a single use login link for the device that asked
+// for it. The email is sent in the background and unknown, disabled or rate
+// limited emails are silently skipped, so registered emails cannot be
+// discovered. Only the per IP limit is reported.
+func (service *authService) RequestMagicLink(c context.Context, data models.MagicLinkRequestDTO) error {
+	emailCount, previous, ipCount, err := service.Repo.RecordMagicLinkRequest(c, data.Email, data.ClientIP, time.Now().Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+	if service.Options.MagicLinkIPPerHour > 0 && ipCount > int64(service.Options.MagicLinkIPPerHour) {
+		return errors.NewError(errors.RateLimited, "too many login links requested, try again later", nil)
+	}
+	if previous != nil && time.Since(*previous) < service.Options.MagicLinkResendInterval {
+		logger.Log(logger.DEBUG, "Magic link requested again too soon, skipped")
+		return nil
+	}
+	if service.Options.MagicLinkPerHour > 0 && emailCount > int64(service.Options.MagicLinkPerHour) {
+		logger.Log(logger.DEBUG, "Too many magic links for one email, skipped")
+		return nil
+	}
+
+	service.background("magic link email", func(c context.Context) error {
+		return service.sendMagicLink(c, data)
+	})
+	return nil
+}
+
+func (service *authService) sendMagicLink(c context.Context, data models.MagicLinkRequestDTO) error {
+	user, err := service.Repo.GetUserByEmail(c, data.Email)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			logger.Log(logger.DEBUG, "Magic link requested for unknown email")
+			return nil
 		}
-		return validatedResponse, nil
+		return err
+	}
+	if user.DisabledAt != nil {
+		return nil
 	}
 
-	return nil, err
+	token, err := service.Repo.CreateMagicLinkToken(c, user.ID, data.DeviceID, service.Options.MagicLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	link := service.Options.AppURL + "/magic-link?token=" + url.QueryEscape(token)
+	return service.Mailer.Send(c, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Daily Diet login link",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Use the link below to log in. It expires in " +
+			service.Options.MagicLinkTTL.String() + ", can only be used once and only on the device you asked for it from.\n\n" +
+			link + "\n\n" +
+			"If you did not try to log in you can ignore this email.",
+	})
 }
 
-func (service *authService) UpdateRefreshToken(c context.Context, refreshToken string, userId string) (*models.RefreshToken, error) {
-	updatedToken, err := service.Repo.UpdateRefreshToken(c, refreshToken, userId)
+// ExchangeMagicLink turns a magic link token into a session bound to the
+// requesting device, with the same response as Login
+func (service *authService) ExchangeMagicLink(c context.Context, data models.MagicLinkExchangeDTO) (*models.LoginResponse, error) {
+	user, err := service.Repo.ConsumeMagicLinkToken(c, data.Token, data.DeviceID)
 	if err != nil {
 		return nil, err
 	}
-	return updatedToken, nil
+	return service.completeLogin(c, user, &data.DeviceID)
+}
+
+func (service *authService) ResetPassword(c context.Context, data models.ResetPasswordDTO) error {
+	return service.Repo.ResetPassword(c, data.Token, data.Password)
+}
+
+func (service *authService) UnverifiedPolicy() string {
+	return service.Options.UnverifiedPolicy
+}
+
+func (service *authService) VerifyEmail(c context.Context, token string) (*models.User, error) {
+	return service.Repo.VerifyEmail(c, token)
+}
+
+// ResendVerification sends a new verification email in the background.
+// Unknown, verified and rate limited emails are skipped silently, so the
+// answer does not reveal whether an account exists.
+func (service *authService) ResendVerification(c context.Context, email string) error {
+	service.background("verification email", func(c context.Context) error {
+		return service.resendVerification(c, email)
+	})
+	return nil
+}
+
+func (service *authService) resendVerification(c context.Context, email string) error {
+	user, err := service.Repo.GetUserByEmail(c, email)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+	if user.VerifiedAt != nil {
+		return nil
+	}
+
+	count, latest, err := service.Repo.CountEmailVerificationTokens(c, user.ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+	if latest != nil && time.Since(*latest) < service.Options.VerificationResendInterval {
+		logger.Log(logger.DEBUG, "Verification email sent recently, skipped")
+		return nil
+	}
+	if service.Options.VerificationResendPerHour > 0 && count >= int64(service.Options.VerificationResendPerHour) {
+		logger.Log(logger.DEBUG, "Too many verification emails, skipped")
+		return nil
+	}
+	return service.SendVerification(c, user)
+}
+
+// SendVerification emails a verification link for the current email of the user
+func (service *authService) SendVerification(c context.Context, user *models.User) error {
+	token, err := service.Repo.CreateEmailVerificationToken(c, user.ID, user.Email, service.Options.VerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := service.Options.APIURL + "/auth/verify?token=" + url.QueryEscape(token)
+	return service.Mailer.Send(c, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your Daily Diet email",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Confirm your email address by opening the link below. It expires in " +
+			service.Options.VerificationTTL.String() + ".\n\n" +
+			link,
+	})
+}
+
+// SendEmailChange emails a confirmation link to the pending email of the user
+// and warns the current address, so a stolen session cannot quietly take the
+// account over
+func (service *authService) SendEmailChange(c context.Context, user *models.User, sessionId *uuid.UUID) error {
+	if user.PendingEmail == nil {
+		return nil
+	}
+	token, err := service.Repo.CreateEmailChangeToken(c, user.ID, *user.PendingEmail, sessionId, service.Options.VerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := service.Options.APIURL + "/auth/verify?token=" + url.QueryEscape(token)
+	if err := service.Mailer.Send(c, mailer.Message{
+		To:      *user.PendingEmail,
+		Subject: "Confirm your new Daily Diet email",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Confirm your new email address by opening the link below. It expires in " +
+			service.Options.VerificationTTL.String() + ".\n\n" +
+			link,
+	}); err != nil {
+		return err
+	}
+	return service.Mailer.Send(c, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Daily Diet email is about to change",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"A change of the email of your account to " + *user.PendingEmail + " was requested. " +
+			"It takes effect once confirmed from the new address.\n\n" +
+			"If you did not ask for it, change your password and sign out your other sessions.",
+	})
 }
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"daily-diet-backend/models"
+	"daily-diet-backend/repositories"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type CoachingService interface {
+	Invite(c context.Context, clientId uuid.UUID, data models.CoachingInviteDTO) (*models.CoachClient, error)
+	ListRelationships(c context.Context, userId uuid.UUID) ([]models.CoachClient, error)
+	Accept(c context.Context, relationId uuid.UUID, coachId uuid.UUID) (*models.CoachClient, error)
+	Decline(c context.Context, relationId uuid.UUID, coachId uuid.UUID) (*models.CoachClient, error)
+	Revoke(c context.Context, relationId uuid.UUID, userId uuid.UUID) (*models.CoachClient, error)
+	ListClientMeals(c context.Context, coachId uuid.UUID, clientId uuid.UUID, query models.ListMealsQuery) (*models.MealsPage, error)
+	GetClientStats(c context.Context, coachId uuid.UUID, clientId uuid.UUID) (*models.UserStats, error)
+}
+
+type coachingService struct {
+	repo          repositories.CoachingRepository
+	mealsRepo     repositories.MealsRepository
+	userStatsRepo repositories.UserStatsRepository
+}
+
+func NewCoachingService(
+	repo repositories.CoachingRepository,
+	mealsRepo repositories.MealsRepository,
+	userStatsRepo repositories.UserStatsRepository,
+) CoachingService {
+	return &coachingService{
+		repo:          repo,
+		mealsRepo:     mealsRepo,
+		userStatsRepo: userStatsRepo,
+	}
+}
+
+func (service *coachingService) Invite(
+	c context.Context,
+	clientId uuid.UUID,
+	data models.CoachingInviteDTO,
+) (*models.CoachClient, error) {
+	scopes := make([]string, 0, len(data.Scopes))
+	seen := map[string]bool{}
+	for _, scope := range data.Scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return service.repo.Invite(c, clientId, data.CoachEmail, strings.Join(scopes, " "))
+}
+
+func (service *coachingService) ListRelationships(c context.Context, userId uuid.UUID) ([]models.CoachClient, error) {
+	return service.repo.ListRelationships(c, userId)
+}
+
+func (service *coachingService) Accept(c context.Context, relationId uuid.UUID, coachId uuid.UUID) (*models.CoachClient, error) {
+	return service.repo.Respond(c, relationId, coachId, true)
+}
+
+func (service *coachingService) Decline(c context.Context, relationId uuid.UUID, coachId uuid.UUID) (*models.CoachClient, error) {
+	return service.repo.Respond(c, relationId, coachId, false)
+}
+
+func (service *coachingService) Revoke(c context.Context, relationId uuid.UUID, userId uuid.UUID) (*models.CoachClient, error) {
+	return service.repo.Revoke(c, relationId, userId)
+}
+
+func (service *coachingService) ListClientMeals(
+	c context.Context,
+	coachId uuid.UUID,
+	clientId uuid.UUID,
+	query models.ListMealsQuery,
+) (*models.MealsPage, error) {
+	return service.mealsRepo.GetMeals(c, coachId, clientId, query)
+}
+
+func (service *coachingService) GetClientStats(c context.Context, coachId uuid.UUID, clientId uuid.UUID) (*models.UserStats, error) {
+	return service.userStatsRepo.GetStats(c, coachId, clientId)
+}
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/repositories"
+	"daily-diet-backend/utils/crypt"
+	"daily-diet-backend/utils/errors"
+	"daily-diet-backend/utils/logger"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// KeyManager signs and verifies JWTs with rotating asymmetric keys shared by
+// every instance through the database
+type KeyManager interface {
+	Sign(claims jwt.Claims) (string, error)
+	// Keyfunc resolves the verification key of a token from its kid header
+	Keyfunc(token *jwt.Token) (interface{}, error)
+	Methods() []string
+	JWKS() models.JWKSet
+	Refresh(c context.Context) error
+	Rotate(c context.Context) error
+	// Run refreshes the keys and rotates them on schedule until c is done
+	Run(c context.Context)
+}
+
+type KeyManagerOptions struct {
+	// models.SigningAlgorithmRS256 or models.SigningAlgorithmEdDSA
+	Algorithm string
+	// Age at which a new signing key replaces the current one
+	RotationInterval time.Duration
+	// How long a replaced key keeps verifying, must exceed the longest token TTL
+	VerificationGrace time.Duration
+	// How often keys created by other instances are picked up
+	RefreshInterval time.Duration
+	// Key the private keys are encrypted with at rest
+	EncryptionKey []byte
+}
+
+// keys are refreshed at most this often when a token has an unknown kid
+const unknownKidRefreshInterval = 10 * time.Second
+
+type loadedKey struct {
+	model   models.SigningKey
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+type keyManager struct {
+	Repo    repositories.SigningKeyRepository
+	Options KeyManagerOptions
+
+	mu          sync.RWMutex
+	keys        []loadedKey
+	lastRefresh time.Time
+}
+
+func NewKeyManager(repo repositories.SigningKeyRepository, options KeyManagerOptions) (KeyManager, error) {
+	if _, err := signingMethod(options.Algorithm); err != nil {
+		return nil, err
+	}
+	if len(options.EncryptionKey) == 0 {
+		return nil, errors.NewError(errors.Invalid, "signing key encryption key is empty", nil)
+	}
+	if options.RefreshInterval <= 0 {
+		options.RefreshInterval = time.Minute
+	}
+	return &keyManager{Repo: repo, Options: options}, nil
+}
+
+func signingMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case models.SigningAlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case models.SigningAlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, errors.NewError(errors.Invalid, "unsupported signing algorithm "+algorithm, nil)
+}
+
+func (manager *keyManager) Methods() []string {
+	return []string{models.SigningAlgorithmRS256, models.SigningAlgorithmEdDSA}
+}
+
+func (manager *keyManager) Sign(claims jwt.Claims) (string, error) {
+	manager.mu.RLock()
+	var current *loadedKey
+	for i := range manager.keys {
+		if manager.keys[i].model.Algorithm == manager.Options.Algorithm {
+			current = &manager.keys[i]
+			break
+		}
+	}
+	manager.mu.RUnlock()
+	if current == nil {
+		return "", errors.NewError(errors.Internal, "no signing key loaded", nil)
+	}
+
+	token := jwt.NewWithClaims(current.method, claims)
+	token.Header["kid"] = current.model.ID
+	signed, err := token.SignedString(current.private)
+	if err != nil {
+		return "", errors.NewError(errors.Internal, "error signing token", err)
+	}
+	return signed, nil
+}
+
+func (manager *keyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no kid header")
+	}
+	key := manager.find(kid)
+	if key == nil && manager.refreshDue(unknownKidRefreshInterval) {
+		// the key may have been created by another instance since the last refresh
+		if err := manager.Refresh(context.Background()); err != nil {
+			logger.Log(logger.ERROR, "Error refreshing signing keys: "+err.Error())
+		}
+		key = manager.find(kid)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown kid %s", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("algorithm %s does not match key %s", token.Method.Alg(), kid)
+	}
+	return key.public, nil
+}
+
+func (manager *keyManager) find(kid string) *loadedKey {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	for i := range manager.keys {
+		if manager.keys[i].model.ID == kid {
+			key := manager.keys[i]
+			return &key
+		}
+	}
+	return nil
+}
+
+func (manager *keyManager) refreshDue(interval time.Duration) bool {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return time.Since(manager.lastRefresh) >= interval
+}
+
+// JWKS returns the public keys of every key still valid for verification
+func (manager *keyManager) JWKS() models.JWKSet {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	set := models.JWKSet{Keys: make([]models.JWK, 0, len(manager.keys))}
+	for _, key := range manager.keys {
+		jwk := models.JWK{
+			Kid: key.model.ID,
+			Use: "sig",
+			Alg: key.model.Algorithm,
+		}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// Refresh reloads the keys from the database and rotates when the current
+// signing key is older than the rotation interval
+func (manager *keyManager) Refresh(c context.Context) error {
+	if err := manager.load(c); err != nil {
+		return err
+	}
+	if manager.rotationDue() {
+		return manager.Rotate(c)
+	}
+	return nil
+}
+
+func (manager *keyManager) rotationDue() bool {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	for _, key := range manager.keys {
+		if key.model.Algorithm == manager.Options.Algorithm {
+			return time.Since(key.model.CreatedAt) >= manager.Options.RotationInterval
+		}
+	}
+	return true
+}
+
+func (manager *keyManager) load(c context.Context) error {
+	rows, err := manager.Repo.ListActiveKeys(c)
+	if err != nil {
+		return err
+	}
+	keys := make([]loadedKey, 0, len(rows))
+	for _, row := range rows {
+		key, err := manager.decode(row)
+		if err != nil {
+			logger.Log(logger.ERROR, "Skipping signing key "+row.ID+": "+err.Error())
+			continue
+		}
+		keys = append(keys, *key)
+	}
+
+	manager.mu.Lock()
+	manager.keys = keys
+	manager.lastRefresh = time.Now()
+	manager.mu.Unlock()
+	return nil
+}
+
+func (manager *keyManager) decode(row models.SigningKey) (*loadedKey, error) {
+	method, err := signingMethod(row.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := crypt.Decrypt(manager.Options.EncryptionKey, row.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("private key cannot sign")
+	}
+	return &loadedKey{
+		model:   row,
+		method:  method,
+		private: private,
+		public:  private.Public(),
+	}, nil
+}
+
+// Rotate creates a new signing key, the previous keys keep verifying until
+// they expire
+func (manager *keyManager) Rotate(c context.Context) error {
+	var private crypto.Signer
+	var err error
+	switch manager.Options.Algorithm {
+	case models.SigningAlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		return errors.NewError(errors.Internal, "error generating signing key", err)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return errors.NewError(errors.Internal, "error encoding signing key", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return errors.NewError(errors.Internal, "error encoding signing key", err)
+	}
+	encrypted, err := crypt.Encrypt(manager.Options.EncryptionKey, base64.StdEncoding.EncodeToString(privateDER))
+	if err != nil {
+		return errors.NewError(errors.Internal, "error encrypting signing key", err)
+	}
+
+	now := time.Now()
+	key := &models.SigningKey{
+		ID:         uuid.NewString(),
+		Algorithm:  manager.Options.Algorithm,
+		PrivateKey: encrypted,
+		PublicKey:  base64.StdEncoding.EncodeToString(publicDER),
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(manager.Options.RotationInterval + manager.Options.VerificationGrace),
+	}
+	if err := manager.Repo.CreateKey(c, key); err != nil {
+		return err
+	}
+	logger.Log(logger.INFO, "Rotated JWT signing key, new kid "+key.ID)
+	return manager.load(c)
+}
+
+func (manager *keyManager) Run(c context.Context) {
+	ticker := time.NewTicker(manager.Options.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := manager.Refresh(c); err != nil {
+			logger.Log(logger.ERROR, "Error refreshing signing keys: "+err.Error())
+		}
+		if _, err := manager.Repo.DeleteExpiredKeys(c); err != nil {
+			logger.Log(logger.ERROR, "Error deleting expired signing keys: "+err.Error())
+		}
+	}
+}
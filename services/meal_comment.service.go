@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"daily-diet-backend/models"
+	"daily-diet-backend/repositories"
+
+	"github.com/google/uuid"
+)
+
+type MealCommentService interface {
+	ListComments(c context.Context, mealId string, viewerId uuid.UUID) ([]models.MealComment, error)
+	CreateComment(c context.Context, mealId string, authorId uuid.UUID, data models.CreateMealCommentDTO) (*models.MealComment, error)
+}
+
+type mealCommentService struct {
+	repo repositories.MealCommentRepository
+}
+
+func NewMealCommentService(repo repositories.MealCommentRepository) MealCommentService {
+	return &mealCommentService{repo: repo}
+}
+
+func (service *mealCommentService) ListComments(
+	c context.Context,
+	mealId string,
+	viewerId uuid.UUID,
+) ([]models.MealComment, error) {
+	return service.repo.ListComments(c, mealId, viewerId)
+}
+
+func (service *mealCommentService) CreateComment(
+	c context.Context,
+	mealId string,
+	authorId uuid.UUID,
+	data models.CreateMealCommentDTO,
+) (*models.MealComment, error) {
+	return service.repo.CreateComment(c, mealId, authorId, data)
+}
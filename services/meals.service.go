@@ -4,18 +4,26 @@ import (
 	"context"
 	"daily-diet-backend/models"
 	"daily-diet-backend/repositories"
+	"daily-diet-backend/utils/errors"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type MealsService interface {
-	GetMeals(c context.Context, userId uuid.UUID) ([]models.Meal, error)
+	GetMeals(c context.Context, userId uuid.UUID, query models.ListMealsQuery) (*models.MealsPage, error)
 	CreateMeal(c context.Context, data models.CreateMealDTO, userId uuid.UUID) (*models.Meal, error)
 	DeleteMeal(c context.Context, mealId string, userId uuid.UUID) error
 	EditMeal(c context.Context, mealId string, userId uuid.UUID, data models.EditMealDTO) (*models.Meal, error)
 	GetMeal(c context.Context, mealId string, userId uuid.UUID) (*models.Meal, error)
+	GetTimeline(c context.Context, userId uuid.UUID, query models.TimelineQuery) (*models.Timeline, error)
+	ListTags(c context.Context, userId uuid.UUID, query models.ListTagsQuery) ([]models.TagUsage, error)
+	GetMacroTotals(c context.Context, userId uuid.UUID, period string, query models.MacroTotalsQuery) ([]models.MacroTotals, error)
 }
 
+// maxMacroTotalsRange bounds the days a totals request can cover
+const maxMacroTotalsRange = 366 * 24 * time.Hour
+
 type mealsService struct {
 	repo repositories.MealsRepository
 }
@@ -24,8 +32,8 @@ func NewMealsService(repo repositories.MealsRepository) MealsService {
 	return &mealsService{repo: repo}
 }
 
-func (service *mealsService) GetMeals(c context.Context, userId uuid.UUID) ([]models.Meal, error) {
-	return service.repo.GetMeals(c, userId)
+func (service *mealsService) GetMeals(c context.Context, userId uuid.UUID, query models.ListMealsQuery) (*models.MealsPage, error) {
+	return service.repo.GetMeals(c, userId, userId, query)
 }
 
 func (service *mealsService) CreateMeal(c context.Context, data models.CreateMealDTO, userId uuid.UUID) (*models.Meal, error) {
@@ -42,9 +50,56 @@ func (service *mealsService) EditMeal(
 	userId uuid.UUID,
 	data models.EditMealDTO,
 ) (*models.Meal, error) {
+	set := map[string]bool{
+		"calories": data.Calories != nil,
+		"protein":  data.Protein != nil,
+		"carbs":    data.Carbs != nil,
+		"fat":      data.Fat != nil,
+		"fiber":    data.Fiber != nil,
+	}
+	for _, macro := range data.ClearMacros {
+		if set[macro] {
+			return nil, errors.NewError(errors.Invalid, macro+" cannot be set and cleared at once", nil)
+		}
+	}
 	return service.repo.EditMeal(c, mealId, userId, data)
 }
 
 func (service *mealsService) GetMeal(c context.Context, mealId string, userId uuid.UUID) (*models.Meal, error) {
 	return service.repo.GetMeal(c, mealId, userId)
 }
+
+func (service *mealsService) GetTimeline(c context.Context, userId uuid.UUID, query models.TimelineQuery) (*models.Timeline, error) {
+	return service.repo.GetTimeline(c, userId, query)
+}
+
+func (service *mealsService) ListTags(c context.Context, userId uuid.UUID, query models.ListTagsQuery) ([]models.TagUsage, error) {
+	return service.repo.ListTags(c, userId, query)
+}
+
+// GetMacroTotals defaults to the last 7 days or the last 8 weeks up to today
+func (service *mealsService) GetMacroTotals(
+	c context.Context,
+	userId uuid.UUID,
+	period string,
+	query models.MacroTotalsQuery,
+) ([]models.MacroTotals, error) {
+	to := time.Now()
+	if query.To != nil {
+		to = *query.To
+	}
+	from := to.AddDate(0, 0, -6)
+	if period == models.MacroPeriodWeek {
+		from = to.AddDate(0, 0, -7*7)
+	}
+	if query.From != nil {
+		from = *query.From
+	}
+	if from.After(to) {
+		return nil, errors.NewError(errors.Invalid, "from must not be after to", nil)
+	}
+	if to.Sub(from) > maxMacroTotalsRange {
+		return nil, errors.NewError(errors.Invalid, "the range cannot exceed 366 days", nil)
+	}
+	return service.repo.GetMacroTotals(c, userId, period, from, to)
+}
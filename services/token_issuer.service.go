@@ -0,0 +1,90 @@
+package services
+
+import (
+	"time"
+
+	"daily-diet-backend/models"
+	"daily-diet-backend/utils/errors"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// TokenIssuer is the single place access tokens are minted and verified, for
+// logins as well as refreshes
+type TokenIssuer interface {
+	IssueAccessToken(user *models.User, sessionId uuid.UUID) (string, time.Time, error)
+	ParseAccessToken(tokenString string) (*models.JwtTokenClaims, error)
+}
+
+type TokenIssuerOptions struct {
+	TTL time.Duration
+	// iss claim, checked on verification
+	Issuer string
+	// aud claim, checked on verification when set
+	Audience string
+}
+
+type tokenIssuer struct {
+	Keys    KeyManager
+	Options TokenIssuerOptions
+}
+
+func NewTokenIssuer(keys KeyManager, options TokenIssuerOptions) TokenIssuer {
+	if options.TTL <= 0 {
+		options.TTL = time.Hour
+	}
+	return &tokenIssuer{Keys: keys, Options: options}
+}
+
+// IssueAccessToken signs an access token for a session of user and returns
+// it with its expiry
+func (issuer *tokenIssuer) IssueAccessToken(user *models.User, sessionId uuid.UUID) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(issuer.Options.TTL)
+	claims := &models.JwtTokenClaims{
+		Email: user.Email,
+		/* store userId, better for fetches latter */
+		ID:        user.ID,
+		Verified:  user.VerifiedAt != nil,
+		Role:      user.Role,
+		SessionID: &sessionId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID.String(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    issuer.Options.Issuer,
+		},
+	}
+	if issuer.Options.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{issuer.Options.Audience}
+	}
+
+	signed, err := issuer.Keys.Sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+func (issuer *tokenIssuer) ParseAccessToken(tokenString string) (*models.JwtTokenClaims, error) {
+	parserOptions := []jwt.ParserOption{
+		jwt.WithValidMethods(issuer.Keys.Methods()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(issuer.Options.Issuer),
+	}
+	if issuer.Options.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(issuer.Options.Audience))
+	}
+
+	claims := &models.JwtTokenClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, issuer.Keys.Keyfunc, parserOptions...)
+	if err != nil {
+		return nil, errors.NewError(errors.Unauthorized, "invalid token", err)
+	}
+	// two factor challenges are signed with the same keys but are no access tokens
+	if !token.Valid || claims.ID == uuid.Nil {
+		return nil, errors.NewError(errors.Unauthorized, "invalid token", nil)
+	}
+	return claims, nil
+}
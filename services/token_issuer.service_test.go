@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"daily-diet-backend/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// staticKeyManager signs with a single Ed25519 key
+type staticKeyManager struct {
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+func newStaticKeyManager(t *testing.T) *staticKeyManager {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &staticKeyManager{private: private, public: public}
+}
+
+func (keys *staticKeyManager) Sign(claims jwt.Claims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims).SignedString(keys.private)
+}
+
+func (keys *staticKeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	return keys.public, nil
+}
+
+func (keys *staticKeyManager) Methods() []string             { return []string{"EdDSA"} }
+func (keys *staticKeyManager) JWKS() models.JWKSet           { return models.JWKSet{} }
+func (keys *staticKeyManager) Refresh(context.Context) error { return nil }
+func (keys *staticKeyManager) Rotate(context.Context) error  { return nil }
+func (keys *staticKeyManager) Run(context.Context)           {}
+
+func TestTokenIssuerRoundTrip(t *testing.T) {
+	keys := newStaticKeyManager(t)
+	issuer := NewTokenIssuer(keys, TokenIssuerOptions{
+		TTL:      time.Minute,
+		Issuer:   "daily-diet",
+		Audience: "daily-diet-api",
+	})
+	now := time.Now()
+	user := &models.User{
+		ID:         uuid.New(),
+		Email:      "user@example.com",
+		Role:       models.RoleCoach,
+		VerifiedAt: &now,
+	}
+	sessionId := uuid.New()
+
+	token, expiresAt, err := issuer.IssueAccessToken(user, sessionId)
+	if err != nil {
+		t.Fatalf("IssueAccessToken: %v", err)
+	}
+	if expiresAt.Before(now.Add(59*time.Second)) || expiresAt.After(now.Add(61*time.Second)) {
+		t.Errorf("expiresAt = %s, want about one minute from now", expiresAt)
+	}
+
+	claims, err := issuer.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("ParseAccessToken: %v", err)
+	}
+	if claims.ID != user.ID || claims.Email != user.Email || claims.Role != user.Role || !claims.Verified {
+		t.Errorf("claims = %+v, want the user fields", claims)
+	}
+	if claims.SessionID == nil || *claims.SessionID != sessionId {
+		t.Errorf("SessionID = %v, want %s", claims.SessionID, sessionId)
+	}
+}
+
+func TestTokenIssuerRejects(t *testing.T) {
+	keys := newStaticKeyManager(t)
+	options := TokenIssuerOptions{TTL: time.Minute, Issuer: "daily-diet", Audience: "daily-diet-api"}
+	verifier := NewTokenIssuer(keys, options)
+	user := &models.User{ID: uuid.New(), Email: "user@example.com", Role: models.RoleUser}
+
+	issue := func(t *testing.T, options TokenIssuerOptions, keys KeyManager) string {
+		token, _, err := NewTokenIssuer(keys, options).IssueAccessToken(user, uuid.New())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	sign := func(t *testing.T, claims jwt.Claims) string {
+		token, err := keys.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name  string
+		token func(t *testing.T) string
+	}{
+		{"other audience", func(t *testing.T) string {
+			return issue(t, TokenIssuerOptions{TTL: time.Minute, Issuer: "daily-diet", Audience: "other-api"}, keys)
+		}},
+		{"no audience", func(t *testing.T) string {
+			return issue(t, TokenIssuerOptions{TTL: time.Minute, Issuer: "daily-diet"}, keys)
+		}},
+		{"other issuer", func(t *testing.T) string {
+			return issue(t, TokenIssuerOptions{TTL: time.Minute, Issuer: "someone-else", Audience: "daily-diet-api"}, keys)
+		}},
+		{"other key", func(t *testing.T) string {
+			return issue(t, options, newStaticKeyManager(t))
+		}},
+		{"expired", func(t *testing.T) string {
+			return sign(t, &models.JwtTokenClaims{
+				ID: user.ID,
+				RegisteredClaims: jwt.RegisteredClaims{
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+					Issuer:    options.Issuer,
+					Audience:  jwt.ClaimStrings{options.Audience},
+				},
+			})
+		}},
+		{"no expiry", func(t *testing.T) string {
+			return sign(t, &models.JwtTokenClaims{
+				ID: user.ID,
+				RegisteredClaims: jwt.RegisteredClaims{
+					Issuer:   options.Issuer,
+					Audience: jwt.ClaimStrings{options.Audience},
+				},
+			})
+		}},
+		{"no user id", func(t *testing.T) string {
+			return sign(t, &models.JwtTokenClaims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+					Issuer:    options.Issuer,
+					Audience:  jwt.ClaimStrings{options.Audience},
+				},
+			})
+		}},
+		{"garbage", func(t *testing.T) string { return "not.a.token" }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := verifier.ParseAccessToken(test.token(t)); err == nil {
+				t.Error("ParseAccessToken accepted the token")
+			}
+		})
+	}
+}
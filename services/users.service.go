@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"daily-diet-backend/models"
+	"daily-diet-backend/repositories"
+	"daily-diet-backend/utils/errors"
+	"daily-diet-backend/utils/logger"
+	"daily-diet-backend/utils/pagination"
+	"strings"
+
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type UsersService interface {
+	GetProfile(c context.Context, userId uuid.UUID) (*models.User, error)
+	UpdateProfile(c context.Context, userId uuid.UUID, data models.UpdateUserDTO, currentSessionId *uuid.UUID) (*models.User, error)
+	ChangePassword(c context.Context, userId uuid.UUID, data models.ChangePasswordDTO, currentSessionId *uuid.UUID) error
+	DeleteAccount(c context.Context, userId uuid.UUID, data models.DeleteAccountDTO) (*time.Time, error)
+	ExportData(c context.Context, userId uuid.UUID) (*models.UserExport, error)
+	CreateAccessToken(c context.Context, userId uuid.UUID, data models.CreatePersonalAccessTokenDTO) (*models.PersonalAccessToken, error)
+	ListAccessTokens(c context.Context, userId uuid.UUID) ([]models.PersonalAccessToken, error)
+	RevokeAccessToken(c context.Context, userId uuid.UUID, tokenId uuid.UUID) error
+}
+
+// lifetime of a personal access token created without expires_in_days
+const defaultAccessTokenLifetimeDays = 30
+
+type usersService struct {
+	repo                repositories.UserRepository
+	mealsRepo           repositories.MealsRepository
+	userStatsRepo       repositories.UserStatsRepository
+	authService         AuthService
+	deletionGracePeriod time.Duration
+}
+
+func NewUsersService(
+	repo repositories.UserRepository,
+	mealsRepo repositories.MealsRepository,
+	userStatsRepo repositories.UserStatsRepository,
+	authService AuthService,
+	deletionGracePeriod time.Duration,
+) UsersService {
+	return &usersService{
+		repo:                repo,
+		mealsRepo:           mealsRepo,
+		userStatsRepo:       userStatsRepo,
+		authService:         authService,
+		deletionGracePeriod: deletionGracePeriod,
+	}
+}
+
+func (service *usersService) GetProfile(c context.Context, userId uuid.UUID) (*models.User, error) {
+	user, err := service.repo.GetUserByID(c, userId.String())
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewError(errors.NotFound, "user not found", err)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (service *usersService) UpdateProfile(
+	c context.Context,
+	userId uuid.UUID,
+	data models.UpdateUserDTO,
+	currentSessionId *uuid.UUID,
+) (*models.User, error) {
+	user, err := service.repo.UpdateUser(c, userId, data)
+	if err != nil {
+		return nil, err
+	}
+	// a new email is only used once confirmed from the new address
+	if data.Email != nil && user.PendingEmail != nil && *data.Email == *user.PendingEmail {
+		if err := service.authService.SendEmailChange(c, user, currentSessionId); err != nil {
+			logger.Log(logger.ERROR, "Error sending email change confirmation: "+err.Error())
+		}
+	}
+	return user, nil
+}
+
+func (service *usersService) ChangePassword(
+	c context.Context,
+	userId uuid.UUID,
+	data models.ChangePasswordDTO,
+	currentSessionId *uuid.UUID,
+) error {
+	return service.repo.ChangePassword(c, userId, data, currentSessionId)
+}
+
+func (service *usersService) DeleteAccount(
+	c context.Context,
+	userId uuid.UUID,
+	data models.DeleteAccountDTO,
+) (*time.Time, error) {
+	return service.repo.ScheduleDeletion(c, userId, data.Password, service.deletionGracePeriod)
+}
+
+func (service *usersService) ExportData(c context.Context, userId uuid.UUID) (*models.UserExport, error) {
+	user, err := service.GetProfile(c, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	// walk every page of the meal listing, oldest first
+	meals := []models.Meal{}
+	query := models.ListMealsQuery{
+		Limit:  pagination.MaxLimit,
+		SortBy: models.MealSortByDate,
+		Order:  models.SortOrderAsc,
+	}
+	for {
+		page, err := service.mealsRepo.GetMeals(c, userId, userId, query)
+		if err != nil {
+			return nil, err
+		}
+		meals = append(meals, page.Meals...)
+		if page.NextCursor == nil {
+			break
+		}
+		query.Cursor = *page.NextCursor
+	}
+
+	stats, err := service.userStatsRepo.GetStats(c, userId, userId)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := service.repo.ListAllRefreshTokens(c, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.UserExport{
+		User:     user,
+		Meals:    meals,
+		Stats:    stats,
+		Sessions: sessions,
+	}, nil
+}
+
+// CreateAccessToken creates a personal access token, its plain value is only
+// available on the returned token
+func (service *usersService) CreateAccessToken(
+	c context.Context,
+	userId uuid.UUID,
+	data models.CreatePersonalAccessTokenDTO,
+) (*models.PersonalAccessToken, error) {
+	days := data.ExpiresInDays
+	if days == 0 {
+		days = defaultAccessTokenLifetimeDays
+	}
+	scopes := make([]string, 0, len(data.Scopes))
+	seen := map[string]bool{}
+	for _, scope := range data.Scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return service.repo.CreatePersonalAccessToken(
+		c,
+		userId,
+		data.Name,
+		strings.Join(scopes, " "),
+		time.Now().AddDate(0, 0, days),
+	)
+}
+
+func (service *usersService) ListAccessTokens(c context.Context, userId uuid.UUID) ([]models.PersonalAccessToken, error) {
+	return service.repo.ListPersonalAccessTokens(c, userId)
+}
+
+func (service *usersService) RevokeAccessToken(c context.Context, userId uuid.UUID, tokenId uuid.UUID) error {
+	return service.repo.RevokePersonalAccessToken(c, userId, tokenId)
+}
@@ -10,6 +10,9 @@ import (
 
 type UserStatsService interface {
 	GetStats(c context.Context, userId uuid.UUID) (*models.UserStats, error)
+	RecomputeStats(c context.Context, userId uuid.UUID) (*models.UserStats, error)
+	RecomputeAllStats(c context.Context) (int, error)
+	GetMealTypeStats(c context.Context, userId uuid.UUID) ([]models.MealTypeStats, error)
 }
 
 type userStatsService struct {
@@ -21,5 +24,17 @@ func NewUserStatsService(repo repositories.UserStatsRepository) UserStatsService
 }
 
 func (s *userStatsService) GetStats(c context.Context, userId uuid.UUID) (*models.UserStats, error) {
-	return s.repo.GetStats(c, userId)
+	return s.repo.GetStats(c, userId, userId)
+}
+
+func (s *userStatsService) RecomputeStats(c context.Context, userId uuid.UUID) (*models.UserStats, error) {
+	return s.repo.RecomputeStats(c, userId)
+}
+
+func (s *userStatsService) RecomputeAllStats(c context.Context) (int, error) {
+	return s.repo.RecomputeAllStats(c)
+}
+
+func (s *userStatsService) GetMealTypeStats(c context.Context, userId uuid.UUID) ([]models.MealTypeStats, error) {
+	return s.repo.GetMealTypeStats(c, userId, userId)
 }
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"daily-diet-backend/utils/logger"
+)
+
+// GetEnv returns the value of an environment variable or fallback when unset
+func GetEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// GetEnvInt returns an integer environment variable or fallback when unset or invalid
+func GetEnvInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		logger.Log(logger.WARNING, "Invalid integer in "+key+", using default")
+		return fallback
+	}
+	return parsed
+}
+
+// GetEnvDuration returns a duration environment variable (e.g. "15m", "24h")
+// or fallback when unset or invalid
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Log(logger.WARNING, "Invalid duration in "+key+", using default")
+		return fallback
+	}
+	return parsed
+}
+
+// requireKey stops the process when a key is empty, an empty secret would
+// make tokens and hashes forgeable and data hashed with it unrecoverable
+func requireKey(name string, key []byte) []byte {
+	if len(key) == 0 {
+		log.Fatal(name + " is empty, set it or JWT_SECRET")
+	}
+	return key
+}
+
+// RefreshTokenHashKey returns the key refresh tokens are hashed with,
+// falling back to JWT_SECRET when REFRESH_TOKEN_HASH_KEY is unset. It exits
+// when both are empty.
+func RefreshTokenHashKey() []byte {
+	if key := GetEnv("REFRESH_TOKEN_HASH_KEY", ""); key != "" {
+		return []byte(key)
+	}
+	logger.Log(logger.WARNING, "REFRESH_TOKEN_HASH_KEY not set, hashing refresh tokens with JWT_SECRET")
+	return requireKey("REFRESH_TOKEN_HASH_KEY", []byte(GetEnv("JWT_SECRET", "")))
+}
+
+// TOTPEncryptionKey returns the key TOTP secrets are encrypted with at rest,
+// falling back to the refresh token hash key when TOTP_ENCRYPTION_KEY is
+// unset. It exits when every candidate is empty.
+func TOTPEncryptionKey() []byte {
+	if key := GetEnv("TOTP_ENCRYPTION_KEY", ""); key != "" {
+		return []byte(key)
+	}
+	logger.Log(logger.WARNING, "TOTP_ENCRYPTION_KEY not set, encrypting TOTP secrets with the refresh token hash key")
+	return RefreshTokenHashKey()
+}
+
+// SigningKeyEncryptionKey returns the key JWT signing keys are encrypted with
+// at rest, falling back to JWT_SECRET when JWT_KEY_ENCRYPTION_KEY is unset.
+// It exits when both are empty.
+func SigningKeyEncryptionKey() []byte {
+	if key := GetEnv("JWT_KEY_ENCRYPTION_KEY", ""); key != "" {
+		return []byte(key)
+	}
+	logger.Log(logger.WARNING, "JWT_KEY_ENCRYPTION_KEY not set, encrypting signing keys with JWT_SECRET")
+	return requireKey("JWT_KEY_ENCRYPTION_KEY", []byte(GetEnv("JWT_SECRET", "")))
+}
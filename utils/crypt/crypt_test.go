@@ -0,0 +1,80 @@
+package crypt
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	tests := []struct {
+		name      string
+		plaintext string
+	}{
+		{"empty", ""},
+		{"totp secret", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"},
+		{"unicode", "clé secrète ✓"},
+	}
+	key := []byte("test encryption key")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encrypted, err := Encrypt(key, test.plaintext)
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			if test.plaintext != "" && encrypted == test.plaintext {
+				t.Fatal("Encrypt returned the plaintext")
+			}
+			decrypted, err := Decrypt(key, encrypted)
+			if err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+			if decrypted != test.plaintext {
+				t.Errorf("Decrypt() = %q, want %q", decrypted, test.plaintext)
+			}
+		})
+	}
+}
+
+func TestEncryptUsesFreshNonces(t *testing.T) {
+	key := []byte("test encryption key")
+	first, err := Encrypt(key, "same value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Encrypt(key, "same value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Error("two encryptions of the same value are identical")
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	key := []byte("test encryption key")
+	encrypted, err := Encrypt(key, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := base64.StdEncoding.DecodeString(encrypted)
+	sealed[len(sealed)-1] ^= 0xff
+	tampered := base64.StdEncoding.EncodeToString(sealed)
+
+	tests := []struct {
+		name      string
+		key       []byte
+		encrypted string
+	}{
+		{"wrong key", []byte("another key"), encrypted},
+		{"tampered ciphertext", key, tampered},
+		{"not base64", key, "%%%"},
+		{"too short", key, base64.StdEncoding.EncodeToString([]byte("short"))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Decrypt(test.key, test.encrypted); err == nil {
+				t.Error("Decrypt succeeded")
+			}
+		})
+	}
+}
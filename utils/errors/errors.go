@@ -10,6 +10,9 @@ const (
 	Invalid      ErrorType = "INVALID"
 	Unauthorized ErrorType = "UNAUTHORIZED"
 	Forbidden    ErrorType = "FORBIDDEN"
+	// TokenReused is returned when an already rotated refresh token is presented
+	TokenReused ErrorType = "TOKEN_REUSED"
+	RateLimited ErrorType = "RATE_LIMITED"
 )
 
 type CustomError struct {
@@ -37,3 +40,26 @@ func NewError(errType ErrorType, message string, err error) *CustomError {
 		Err:     err,
 	}
 }
+
+// HTTPStatus maps an error to the HTTP status code matching its ErrorType.
+// Errors not created through NewError are treated as internal errors.
+func HTTPStatus(err error) int {
+	customErr, ok := err.(*CustomError)
+	if !ok {
+		return 500
+	}
+	switch customErr.Type {
+	case NotFound:
+		return 404
+	case Invalid:
+		return 400
+	case Unauthorized, TokenReused:
+		return 401
+	case Forbidden:
+		return 403
+	case RateLimited:
+		return 429
+	default:
+		return 500
+	}
+}
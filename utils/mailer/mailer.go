@@ -0,0 +1,123 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"daily-diet-backend/utils/config"
+	"daily-diet-backend/utils/logger"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional emails
+type Mailer interface {
+	Send(c context.Context, message Message) error
+}
+
+// NewMailerFromEnv picks the implementation from MAILER_DRIVER: "smtp",
+// "file" (appends to MAILER_FILE) or "stdout". The driver is required, mails
+// carry login and reset links that must not end up in logs by accident.
+func NewMailerFromEnv() Mailer {
+	from := config.GetEnv("MAIL_FROM", "no-reply@dailydiet.local")
+	driver := config.GetEnv("MAILER_DRIVER", "")
+	switch driver {
+	case "smtp":
+		return NewSMTPMailer(
+			config.GetEnv("SMTP_HOST", "localhost"),
+			config.GetEnv("SMTP_PORT", "587"),
+			config.GetEnv("SMTP_USER", ""),
+			config.GetEnv("SMTP_PASSWORD", ""),
+			from,
+		)
+	case "file":
+		path := config.GetEnv("MAILER_FILE", "mails.log")
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Fatal("Could not open MAILER_FILE " + path + ": " + err.Error())
+		}
+		return NewWriterMailer(file, from)
+	case "stdout":
+		logger.Log(logger.WARNING, "MAILER_DRIVER=stdout, emails including login links are written to the logs")
+		return NewWriterMailer(os.Stdout, from)
+	case "":
+		log.Fatal("MAILER_DRIVER is not set, use smtp, file or stdout")
+	default:
+		log.Fatal("Unknown MAILER_DRIVER " + driver + ", use smtp, file or stdout")
+	}
+	return nil
+}
+
+type smtpMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) Mailer {
+	return &smtpMailer{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+func (m *smtpMailer) Send(c context.Context, message Message) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	return smtp.SendMail(
+		m.host+":"+m.port,
+		auth,
+		m.from,
+		[]string{message.To},
+		[]byte(format(m.from, message)),
+	)
+}
+
+// writerMailer writes mails to an io.Writer, for local development and tests
+type writerMailer struct {
+	mu   sync.Mutex
+	out  io.Writer
+	from string
+}
+
+func NewWriterMailer(out io.Writer, from string) Mailer {
+	return &writerMailer{out: out, from: from}
+}
+
+func (m *writerMailer) Send(c context.Context, message Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(m.out, "%s\n", format(m.from, message))
+	return err
+}
+
+// format renders a message as a plain text RFC 5322 email
+func format(from string, message Message) string {
+	var builder strings.Builder
+	builder.WriteString("From: " + from + "\r\n")
+	builder.WriteString("To: " + message.To + "\r\n")
+	builder.WriteString("Subject: " + message.Subject + "\r\n")
+	builder.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(message.Body + "\r\n")
+	return builder.String()
+}
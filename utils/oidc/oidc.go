@@ -0,0 +1,369 @@
+// Package oidc is a minimal OpenID Connect relying party: discovery, the
+// authorization code flow with PKCE (S256) and ID token verification against
+// the provider's JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksRefreshInterval is how often the keys are refetched at most when an ID
+// token has an unknown kid
+const jwksRefreshInterval = 10 * time.Second
+
+type Options struct {
+	// Issuer URL, the discovery document is read from
+	// <Issuer>/.well-known/openid-configuration
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Where the provider sends the user back with the code, must be
+	// registered with the provider
+	RedirectURL string
+	Scopes      []string
+	// Defaults to a client with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+// Metadata is the part of the discovery document the flow needs
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims of a verified ID token
+type Claims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Nonce         string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+type Provider struct {
+	options Options
+	client  *http.Client
+
+	mu          sync.RWMutex
+	metadata    *Metadata
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+// NewProvider returns a provider, the discovery document is fetched on first
+// use so the API starts when the provider is down
+func NewProvider(options Options) *Provider {
+	client := options.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(options.Scopes) == 0 {
+		options.Scopes = []string{"openid", "email", "profile"}
+	}
+	options.Issuer = strings.TrimSuffix(options.Issuer, "/")
+	return &Provider{options: options, client: client}
+}
+
+// Issuer returns the configured issuer, identities are keyed by it
+func (provider *Provider) Issuer() string {
+	return provider.options.Issuer
+}
+
+// Discover returns the discovery document, fetched once
+func (provider *Provider) Discover(c context.Context) (*Metadata, error) {
+	provider.mu.RLock()
+	metadata := provider.metadata
+	provider.mu.RUnlock()
+	if metadata != nil {
+		return metadata, nil
+	}
+
+	metadata = &Metadata{}
+	if err := provider.getJSON(c, provider.options.Issuer+"/.well-known/openid-configuration", metadata); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != provider.options.Issuer {
+		return nil, fmt.Errorf("discovery issuer %s does not match %s", metadata.Issuer, provider.options.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("incomplete discovery document")
+	}
+
+	provider.mu.Lock()
+	provider.metadata = metadata
+	provider.mu.Unlock()
+	return metadata, nil
+}
+
+// RandomString returns a url safe random string, for states, nonces and
+// PKCE verifiers
+func RandomString() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// CodeChallenge returns the S256 PKCE challenge of a verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL the user is sent to for signing in
+func (provider *Provider) AuthCodeURL(c context.Context, state string, nonce string, verifier string) (string, error) {
+	metadata, err := provider.Discover(c)
+	if err != nil {
+		return "", err
+	}
+	endpoint, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	query := endpoint.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.options.ClientID)
+	query.Set("redirect_uri", provider.options.RedirectURL)
+	query.Set("scope", strings.Join(provider.options.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified claims of
+// the ID token
+func (provider *Provider) Exchange(c context.Context, code string, verifier string, nonce string) (*Claims, error) {
+	metadata, err := provider.Discover(c)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.options.RedirectURL)
+	form.Set("code_verifier", verifier)
+	request, err := http.NewRequestWithContext(c, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(provider.options.ClientID), url.QueryEscape(provider.options.ClientSecret))
+
+	response, err := provider.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", response.StatusCode, body)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+	return provider.Verify(c, tokens.IDToken, nonce)
+}
+
+// Verify checks the signature, issuer, audience, expiry and nonce of an ID
+// token
+func (provider *Provider) Verify(c context.Context, idToken string, nonce string) (*Claims, error) {
+	metadata, err := provider.Discover(c)
+	if err != nil {
+		return nil, err
+	}
+	claims := &Claims{}
+	_, err = jwt.ParseWithClaims(idToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return provider.key(c, metadata.JWKSURI, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(provider.options.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("id token has no subject")
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("id token nonce does not match")
+	}
+	return claims, nil
+}
+
+// key returns the JWKS key of kid, refetching the set when kid is unknown
+func (provider *Provider) key(c context.Context, jwksURI string, kid string) (interface{}, error) {
+	provider.mu.RLock()
+	key, ok := provider.lookup(kid)
+	due := time.Since(provider.keysFetched) >= jwksRefreshInterval
+	provider.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if !due {
+		return nil, fmt.Errorf("unknown kid %s", kid)
+	}
+
+	keys, err := provider.fetchKeys(c, jwksURI)
+	if err != nil {
+		return nil, err
+	}
+	provider.mu.Lock()
+	provider.keys = keys
+	provider.keysFetched = time.Now()
+	key, ok = provider.lookup(kid)
+	provider.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %s", kid)
+	}
+	return key, nil
+}
+
+// lookup must be called with mu held. A token without kid matches the only
+// key of a single key set.
+func (provider *Provider) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(provider.keys) == 1 {
+		for _, key := range provider.keys {
+			return key, true
+		}
+	}
+	key, ok := provider.keys[kid]
+	return key, ok
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (provider *Provider) fetchKeys(c context.Context, jwksURI string) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := provider.getJSON(c, jwksURI, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseKey(jwk)
+		if err != nil {
+			// keys of unsupported types are skipped, not fatal
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func parseKey(jwk jsonWebKey) (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+}
+
+func (provider *Provider) getJSON(c context.Context, target string, value interface{}) error {
+	request, err := http.NewRequestWithContext(c, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	response, err := provider.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", target, response.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(value)
+}
@@ -0,0 +1,284 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "daily-diet"
+	testClientSecret = "client secret"
+	testKid          = "rsa-1"
+	testCode         = "authorization-code"
+	testVerifier     = "pkce-verifier"
+	testNonce        = "nonce-1"
+)
+
+// mockProvider is an identity provider serving discovery, JWKS and the token
+// endpoint, the token endpoint answers with idToken
+type mockProvider struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	idToken string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &mockProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{
+			Issuer:                mock.server.URL,
+			AuthorizationEndpoint: mock.server.URL + "/authorize",
+			TokenEndpoint:         mock.server.URL + "/token",
+			JWKSURI:               mock.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []jsonWebKey{rsaJWK(testKid, &key.PublicKey)}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientId, secret, ok := r.BasicAuth()
+		if !ok || clientId != testClientID || secret != url.QueryEscape(testClientSecret) {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.PostFormValue("code") != testCode || r.PostFormValue("code_verifier") != testVerifier ||
+			r.PostFormValue("grant_type") != "authorization_code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": mock.idToken})
+	})
+	mock.server = httptest.NewServer(mux)
+	t.Cleanup(mock.server.Close)
+	return mock
+}
+
+func (mock *mockProvider) provider() *Provider {
+	return NewProvider(Options{
+		Issuer:       mock.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  "http://localhost:3000/auth/callback",
+		HTTPClient:   mock.server.Client(),
+	})
+}
+
+// claims returns valid ID token claims, edit lets a test break one
+func (mock *mockProvider) claims(edit func(claims *Claims)) *Claims {
+	claims := &Claims{
+		Email:         "user@example.com",
+		EmailVerified: true,
+		Nonce:         testNonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    mock.server.URL,
+			Subject:   "subject-1",
+			Audience:  jwt.ClaimStrings{testClientID},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	if edit != nil {
+		edit(claims)
+	}
+	return claims
+}
+
+func (mock *mockProvider) sign(t *testing.T, claims *Claims, kid string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(mock.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) jsonWebKey {
+	return jsonWebKey{
+		Kid: kid,
+		Kty: "RSA",
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func TestExchange(t *testing.T) {
+	mock := newMockProvider(t)
+	mock.idToken = mock.sign(t, mock.claims(nil), testKid)
+	provider := mock.provider()
+
+	claims, err := provider.Exchange(context.Background(), testCode, testVerifier, testNonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "user@example.com" || !claims.EmailVerified {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	if _, err := provider.Exchange(context.Background(), "other-code", testVerifier, testNonce); err == nil {
+		t.Error("Exchange accepted a code the provider refused")
+	}
+	if _, err := provider.Exchange(context.Background(), testCode, "other-verifier", testNonce); err == nil {
+		t.Error("Exchange accepted a wrong PKCE verifier")
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	mock := newMockProvider(t)
+	authURL, err := mock.provider().AuthCodeURL(context.Background(), "state-1", testNonce, testVerifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"state":                 "state-1",
+		"nonce":                 testNonce,
+		"code_challenge":        CodeChallenge(testVerifier),
+		"code_challenge_method": "S256",
+		"scope":                 "openid email profile",
+	}
+	for name, value := range want {
+		if got := query.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	mock := newMockProvider(t)
+	hmacToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, mock.claims(nil)).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		nonce   string
+		wantErr bool
+	}{
+		{"valid", mock.sign(t, mock.claims(nil), testKid), testNonce, false},
+		{"no kid with a single key", mock.sign(t, mock.claims(nil), ""), testNonce, false},
+		{"wrong nonce", mock.sign(t, mock.claims(nil), testKid), "other-nonce", true},
+		{"other audience", mock.sign(t, mock.claims(func(claims *Claims) {
+			claims.Audience = jwt.ClaimStrings{"someone-else"}
+		}), testKid), testNonce, true},
+		{"other issuer", mock.sign(t, mock.claims(func(claims *Claims) {
+			claims.Issuer = "https://evil.example.com"
+		}), testKid), testNonce, true},
+		{"expired", mock.sign(t, mock.claims(func(claims *Claims) {
+			claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+		}), testKid), testNonce, true},
+		{"no expiry", mock.sign(t, mock.claims(func(claims *Claims) {
+			claims.ExpiresAt = nil
+		}), testKid), testNonce, true},
+		{"no subject", mock.sign(t, mock.claims(func(claims *Claims) {
+			claims.Subject = ""
+		}), testKid), testNonce, true},
+		{"unknown kid", mock.sign(t, mock.claims(nil), "rsa-2"), testNonce, true},
+		{"symmetric algorithm", hmacToken, testNonce, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// a fresh provider per case, unknown kids are only refetched every few seconds
+			_, err := mock.provider().Verify(context.Background(), test.token, test.nonce)
+			if (err != nil) != test.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestDiscoverRejectsIssuerMismatch(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := NewProvider(Options{
+		Issuer:     mock.server.URL + "/other",
+		ClientID:   testClientID,
+		HTTPClient: mock.server.Client(),
+	})
+	if _, err := provider.Discover(context.Background()); err == nil {
+		t.Error("Discover accepted a document for another issuer")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := base64.RawURLEncoding.EncodeToString
+	ecX := encode(ecKey.X.FillBytes(make([]byte, 32)))
+	ecY := encode(ecKey.Y.FillBytes(make([]byte, 32)))
+
+	tests := []struct {
+		name    string
+		jwk     jsonWebKey
+		check   func(key interface{}) bool
+		wantErr bool
+	}{
+		{"RSA", rsaJWK("rsa", &rsaKey.PublicKey), func(key interface{}) bool {
+			public, ok := key.(*rsa.PublicKey)
+			return ok && public.Equal(&rsaKey.PublicKey)
+		}, false},
+		{"EC P-256", jsonWebKey{Kty: "EC", Crv: "P-256", X: ecX, Y: ecY}, func(key interface{}) bool {
+			public, ok := key.(*ecdsa.PublicKey)
+			return ok && public.Equal(&ecKey.PublicKey)
+		}, false},
+		{"Ed25519", jsonWebKey{Kty: "OKP", Crv: "Ed25519", X: encode(edPublic)}, func(key interface{}) bool {
+			public, ok := key.(ed25519.PublicKey)
+			return ok && public.Equal(edPublic)
+		}, false},
+		{"RSA with invalid modulus", jsonWebKey{Kty: "RSA", N: "***", E: "AQAB"}, nil, true},
+		{"EC with unsupported curve", jsonWebKey{Kty: "EC", Crv: "P-521", X: ecX, Y: ecY}, nil, true},
+		{"OKP with unsupported curve", jsonWebKey{Kty: "OKP", Crv: "X25519", X: encode(edPublic)}, nil, true},
+		{"Ed25519 of the wrong size", jsonWebKey{Kty: "OKP", Crv: "Ed25519", X: encode(edPublic[:16])}, nil, true},
+		{"symmetric key", jsonWebKey{Kty: "oct"}, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := parseKey(test.jwk)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseKey() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.check != nil && !test.check(key) {
+				t.Errorf("parseKey() = %#v, not the encoded key", key)
+			}
+		})
+	}
+}
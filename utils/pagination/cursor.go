@@ -0,0 +1,56 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Cursor holds the sort key of the last item returned in a page.
+// Only the fields used by the requested sort are filled.
+type Cursor struct {
+	ID        uuid.UUID  `json:"id"`
+	Date      *time.Time `json:"date,omitempty"`
+	Time      *time.Time `json:"time,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// Encode serializes the cursor into an opaque url-safe string
+func Encode(cursor Cursor) (string, error) {
+	raw, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Decode parses a string created by Encode
+func Decode(encoded string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// NormalizeLimit clamps a requested page size to [1, MaxLimit]
+func NormalizeLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultLimit
+	}
+	if limit > MaxLimit {
+		return MaxLimit
+	}
+	return limit
+}
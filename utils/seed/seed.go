@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"daily-diet-backend/models"
+	"daily-diet-backend/repositories"
 	"daily-diet-backend/utils/crypt"
 	"daily-diet-backend/utils/errors"
 	"daily-diet-backend/utils/logger"
@@ -28,11 +29,13 @@ func SeedDatabase(db *gorm.DB, ctx context.Context) error {
 	if len(users) == 0 {
 		// Create test user
 		hashedPassword, _ := crypt.HashPassword("test122")
+		verifiedAt := time.Now()
 
 		toCreateUser := &models.User{
-			Email:    "leo@mail.com",
-			Name:     "Leo Messi",
-			Password: string(hashedPassword),
+			Email:      "leo@mail.com",
+			Name:       "Leo Messi",
+			Password:   string(hashedPassword),
+			VerifiedAt: &verifiedAt,
 		}
 		meals := []models.Meal{
 			{
@@ -41,7 +44,6 @@ func SeedDatabase(db *gorm.DB, ctx context.Context) error {
 				Time:        time.Date(2024, 1, 15, 8, 30, 0, 0, time.Local),
 				InDiet:      true,
 				Description: "Oatmeal with fruits and honey",
-				UserID:      toCreateUser.ID,
 			},
 			{
 				Name:        "Fast Food Lunch",
@@ -49,7 +51,6 @@ func SeedDatabase(db *gorm.DB, ctx context.Context) error {
 				Time:        time.Date(2024, 1, 15, 12, 45, 0, 0, time.Local),
 				InDiet:      false,
 				Description: "Double cheeseburger with fries",
-				UserID:      toCreateUser.ID,
 			},
 			{
 				Name:        "Healthy Dinner",
@@ -57,7 +58,6 @@ func SeedDatabase(db *gorm.DB, ctx context.Context) error {
 				Time:        time.Date(2024, 1, 15, 19, 0, 0, 0, time.Local),
 				InDiet:      true,
 				Description: "Grilled chicken with salad",
-				UserID:      toCreateUser.ID,
 			},
 			{
 				Name:        "Late Night Snack",
@@ -65,7 +65,6 @@ func SeedDatabase(db *gorm.DB, ctx context.Context) error {
 				Time:        time.Date(2024, 1, 15, 23, 15, 0, 0, time.Local),
 				InDiet:      false,
 				Description: "Chocolate cake and ice cream",
-				UserID:      toCreateUser.ID,
 			},
 		}
 		result := db.WithContext(ctx).Create(toCreateUser)
@@ -78,6 +77,7 @@ func SeedDatabase(db *gorm.DB, ctx context.Context) error {
 		// Create meals
 
 		for _, meal := range meals {
+			meal.UserID = toCreateUser.ID
 			result = db.WithContext(ctx).Create(&meal)
 			if result.Error != nil {
 				err := result.Error
@@ -86,17 +86,12 @@ func SeedDatabase(db *gorm.DB, ctx context.Context) error {
 			}
 		}
 
-		toCreateUserStats := &models.UserStats{
-			UserID:          toCreateUser.ID,
-			RegisteredMeals: 4,
-			InDietMeals:     2,
-			CurrentStreak:   0, // Reset to 0 since last meal was not in diet
-			MaxStreak:       2, // Had 2 meals in diet in sequence
-		}
-
-		result = db.WithContext(ctx).Create(toCreateUserStats)
-		if result.Error != nil {
-			err := result.Error
+		// Derive user stats from the seeded meals
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			_, err := repositories.RecomputeUserStats(tx, ctx, toCreateUser.ID)
+			return err
+		})
+		if err != nil {
 			logger.Log(logger.ERROR, "Error creating user stats :: "+err.Error())
 			return errors.NewError(errors.Internal, "Error creating user stats :: ", err)
 		}
@@ -0,0 +1,71 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// base32 of the ASCII secret "12345678901234567890" of RFC 6238 appendix B
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC lists 8 digit SHA1 codes, these are their last 6 digits
+func TestCodeRFC6238Vectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, test := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", test.unix, err)
+		}
+		if code != test.code {
+			t.Errorf("Code(%d) = %s, want %s", test.unix, code, test.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	codeAt := func(step int64) string {
+		code, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOk   bool
+	}{
+		{"current step", rfcSecret, codeAt(current), current, true},
+		{"previous step", rfcSecret, codeAt(current - 1), current - 1, true},
+		{"next step", rfcSecret, codeAt(current + 1), current + 1, true},
+		{"surrounding spaces", rfcSecret, " " + codeAt(current) + " ", current, true},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", codeAt(current), current, true},
+		{"outside the skew", rfcSecret, codeAt(current - 2), 0, false},
+		{"wrong code", rfcSecret, "000000", 0, false},
+		{"too short", rfcSecret, codeAt(current)[:5], 0, false},
+		{"invalid secret", "not base32!", codeAt(current), 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			step, ok := Validate(test.secret, test.code, now)
+			if ok != test.wantOk || step != test.wantStep {
+				t.Errorf("Validate() = %d, %v, want %d, %v", step, ok, test.wantStep, test.wantOk)
+			}
+		})
+	}
+}